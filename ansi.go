@@ -8,13 +8,17 @@ import (
 	"encoding/base64"
 	"errors"
 	"image"
-	"strconv"
+	"slices"
 	"strings"
 
+	"github.com/sparques/fansiterm/parser"
 	"golang.org/x/exp/constraints"
 )
 
-var errEscapeSequenceIncomplete = errors.New("escape sequence incomplete")
+var (
+	errEscapeSequenceIncomplete = errors.New("escape sequence incomplete")
+	errImageTooBig              = errors.New("image too large")
+)
 
 var (
 	// ShowEsc if set to true (default false) prints to stdout escape sequences as received by fansiterm
@@ -43,10 +47,28 @@ func (d *Device) handleEscSequence(seq []rune) {
 	// 	d.cursor.MoveAbs(0, 0)
 	// 	// abuse inputBuf...
 	// 	d.inputBuf = append(d.inputBuf, slices.Repeat([]rune{'E'}, d.rows*d.cols)...)
-	case '[':
-		d.handleCSISequence(seq[2:])
-	case ']':
-		d.handleOSCSequence(seq[2:])
+	case 'D': // IND: move cursor down; if at bottom of scroll region, scroll
+		d.index()
+	case 'E': // NEL: next line
+		d.cursor.col = 0
+		d.index()
+	case 'H': // HTS: set a tab stop at the cursor
+		d.setTabStop(true)
+	case ' ':
+		switch seq[2] {
+		case 'F': // S7C1T: 7 bit controls in replies
+			d.c1Replies = false
+		case 'G': // S8C1T: 8 bit controls in replies
+			d.c1Replies = true
+		}
+	case '%': // DOCS: select the host encoding
+		switch seq[2] {
+		case 'G':
+			d.Config.HostEncoding = EncodingUTF8
+		case '@':
+			d.Config.HostEncoding = EncodingLatin1
+		}
+		d.configChange()
 	case 'M': // Move cursor up; if at top of screen, scroll up one line
 		if d.cursor.row == 0 {
 			d.Scroll(-1)
@@ -76,12 +98,12 @@ func (d *Device) handleEscSequence(seq []rune) {
 			// d.Render.G1 = d.Render.CharSet
 			d.Render.active.g[1] = &d.Render.CharSet
 		}
-	case '/':
-		d.handleFansiSequence(seq[2:])
-	case '>': // auxilary keypad numeric mode
-		fallthrough
-	case '=': // auxilary keypad application mode
-		fallthrough
+	case '>': // DECKPNM: auxilary keypad numeric mode
+		d.Config.KeypadApplicationMode = false
+		d.configChange()
+	case '=': // DECKPAM: auxilary keypad application mode
+		d.Config.KeypadApplicationMode = true
+		d.configChange()
 	default:
 		if ShowUnhandled {
 			log.Warn("unhandled escape sequence", "sequence", seqString(seq))
@@ -90,77 +112,48 @@ func (d *Device) handleEscSequence(seq []rune) {
 	d.updateAttr()
 }
 
-// consumeEscSequence figures out where the escape sequence in data ends.
-// It assumes data[0] == 0x1b.
-func consumeEscSequence(data []rune) (n int, err error) {
-	if len(data) < 2 {
-		// need more bytes
-		return 0, errEscapeSequenceIncomplete
+// numericArgs returns the value of each parameter, or def for those that
+// were omitted. Any ':' subparameters are ignored; use params.Sub to get at
+// them. There is always at least one value.
+func numericArgs(params *parser.Params, def int) []int {
+	args := make([]int, max(params.Len(), 1))
+	for i := range args {
+		args[i] = params.Get(i, def)
 	}
-	switch data[1] {
-	case 'X', ']', 'P', '/': // SOS, OSC, DCS, and my own private sequence
-		// For Start of String, Operating System Command, and Device Control String, read
-		// until we encounter String Terminator, ESC\
-		for n = 1; n < len(data); n++ {
-			// handle ESC]R
-			if n == 2 && data[n] == 'R' && data[n-1] == ']' {
-				return n + 2, nil
-			}
-			if data[n] == '\a' || (data[n-1] == 0x1b && data[n] == '\\') {
-				return n + 1, nil
-			}
-		}
-	case '[': // CSI
-		for n = 2; n < len(data); n++ {
-			if data[n] >= 0x40 {
-				return n + 1, nil
-			}
-		}
-		return 0, errEscapeSequenceIncomplete
-	case '(', ')':
-		if len(data) < 3 {
-			return 0, errEscapeSequenceIncomplete
+	return args
+}
+
+// Param is a single CSI or DCS parameter: its value followed by any ':'
+// separated subparameters (ITU T.416). Omitted values are -1, so that
+// 38:2::255:0:0 is {38, 2, -1, 255, 0, 0}.
+type Param []int
+
+// getParams copies params out of the parser, so they can outlive the call
+// that handed them over. As with numericArgs, there is always at least one;
+// an omitted parameter is {-1}.
+func getParams(params *parser.Params) []Param {
+	out := make([]Param, max(params.Len(), 1))
+	for i := range out {
+		out[i] = Param(slices.Clone(params.Sub(i)))
+		if len(out[i]) == 0 {
+			out[i] = Param{-1}
 		}
-		// ESC(0 for line drawing
-		// ESC(B for regular
-		return 3, nil
-	default:
-		// Unsupported escape sequence, just skip it?
-		return 2, nil
 	}
-
-	// got to here? need more data
-	return 0, errEscapeSequenceIncomplete
+	return out
 }
 
-// getNumericArgs beaks apart seq at ';' characters and then tries to convert
-// each piece into an integer. If it fails to convert, def is used.
-func getNumericArgs(seq []rune, def int) (args []int) {
-	for _, arg := range splitParams(seq) {
-		num, err := strconv.Atoi(string(arg))
-		if err != nil {
-			num = def
-		}
-		args = append(args, num)
+// Get returns the i'th value of p, or def if it is missing or was omitted.
+func (p Param) Get(i, def int) int {
+	if i >= len(p) || p[i] < 0 {
+		return def
 	}
-	return args
+	return p[i]
 }
 
 func bound[N constraints.Integer](x, minimum, maximum N) N {
 	return min(max(x, minimum), maximum)
 }
 
-func trimST(seq []rune) []rune {
-	switch {
-	case seq[len(seq)-1] == '\a':
-		return seq[:len(seq)-1]
-	case seq[len(seq)-2] == 0x1b && seq[len(seq)-1] == '\\':
-		return seq[:len(seq)-2]
-	default:
-		return seq
-	}
-}
-
 // DecodeImageData accepts base64 encoded data and attempts to
 // decode it as an image, returning the image.
 func DecodeImageData(data []rune) (image.Image, error) {
@@ -174,6 +167,21 @@ func DecodeImageData(data []rune) (image.Image, error) {
 	return img, err
 }
 
+// decodeImage decodes data as an image, first checking from its header that
+// it's no more than limit bytes as RGBA, so that a small file claiming to be
+// a huge image can't use up the memory.
+func decodeImage(data []byte, limit int) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width > 0 && cfg.Height > limit/4/cfg.Width {
+		return nil, errImageTooBig
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
 func splitParams(data []rune) (split [][]rune) {
 	prev := 0
 	for i := range data {
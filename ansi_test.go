@@ -0,0 +1,47 @@
+package fansiterm
+
+import (
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestGetParams(t *testing.T) {
+	tests := []struct {
+		seq  string
+		want []Param
+	}{
+		{"", []Param{{-1}}},
+		{"1", []Param{{1}}},
+		{"38;5;100", []Param{{38}, {5}, {100}}},
+		{"38;2;1;2;3", []Param{{38}, {2}, {1}, {2}, {3}}},
+		{"38:2::1:2:3", []Param{{38, 2, -1, 1, 2, 3}}},
+		{"38:2:1:2:3", []Param{{38, 2, 1, 2, 3}}},
+		{"4:3", []Param{{4, 3}}},
+		{";5", []Param{{-1}, {5}}},
+		{"1;;2", []Param{{1}, {-1}, {2}}},
+		{"1:", []Param{{1, -1}}},
+	}
+	d := New(10, 4, nil)
+	var got []Param
+	d.HandleCSI('m', "", func(params []Param, reply io.Writer) bool {
+		got = params
+		return true
+	})
+	for _, tt := range tests {
+		got = nil
+		d.write([]byte("\x1b[" + tt.seq + "m"))
+		if !slices.EqualFunc(got, tt.want, slices.Equal) {
+			t.Errorf("getParams(%q) = %v, want %v", tt.seq, got, tt.want)
+		}
+	}
+}
+
+func TestParamGet(t *testing.T) {
+	p := Param{4, -1, 7}
+	for i, want := range []int{4, 9, 7, 9} {
+		if got := p.Get(i, 9); got != want {
+			t.Errorf("Get(%d, 9) = %d, want %d", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package fansiterm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+)
+
+// ansiart.go plays back ANSI art (.ANS files) the way a DOS BBS would have
+// shown it: CP437, 80 columns, optionally iCE colors, trickling in at modem
+// speed. The SAUCE record (https://www.acid.org/info/sauce/sauce.htm) at the
+// end of a file, if there is one, supplies the width and font.
+
+// sauceSize is the size of a SAUCE record.
+const sauceSize = 128
+
+// SAUCE is the metadata record appended to ANSI art and similar files.
+type SAUCE struct {
+	Title, Author, Group string
+	// Date is CCYYMMDD.
+	Date     string
+	FileSize uint32
+	DataType uint8
+	FileType uint8
+	// TInfo's meaning depends on DataType and FileType; for ANSI art
+	// TInfo[0] is the width in characters and TInfo[1] the height.
+	TInfo    [4]uint16
+	Comments []string
+	Flags    uint8
+	// Font is a font name like "IBM VGA" (TInfoS).
+	Font string
+}
+
+// Columns returns the width of the art in characters, or 0 if the record
+// doesn't say.
+func (s SAUCE) Columns() int {
+	switch {
+	case s.DataType == 1 && s.FileType <= 2: // ASCII, ANSi, ANSiMation
+		return int(s.TInfo[0])
+	case s.DataType == 5: // BinaryText; the width is stored halved
+		return int(s.FileType) * 2
+	}
+	return 0
+}
+
+// ICEColors is whether the art uses iCE colors (blink means a bright
+// background).
+func (s SAUCE) ICEColors() bool {
+	return s.Flags&1 != 0
+}
+
+// iceBackground returns bg made bright, or back to normal, for iCE colors.
+// Only the eight ANSI colors have bright versions; the default background
+// counts as black, as it always was on DOS.
+func (d *Device) iceBackground(bg Color, bright bool) Color {
+	if bright && bg == d.attrDefault.Bg {
+		return ColorANSI(8)
+	}
+	for i := range 8 {
+		switch {
+		case bright && bg == ColorANSI(i):
+			return ColorANSI(i + 8)
+		case !bright && bg == ColorANSI(i+8):
+			return ColorANSI(i)
+		}
+	}
+	return bg
+}
+
+// ParseSAUCE looks for a SAUCE record at the end of data. If there is one,
+// body is data without the record and any comment block.
+func ParseSAUCE(data []byte) (sauce SAUCE, body []byte, ok bool) {
+	if len(data) < sauceSize {
+		return sauce, data, false
+	}
+	rec := data[len(data)-sauceSize:]
+	if string(rec[:5]) != "SAUCE" {
+		return sauce, data, false
+	}
+
+	field := func(b []byte) string {
+		return strings.TrimRight(string(b), " \x00")
+	}
+	sauce = SAUCE{
+		Title:    field(rec[7:42]),
+		Author:   field(rec[42:62]),
+		Group:    field(rec[62:82]),
+		Date:     field(rec[82:90]),
+		FileSize: binary.LittleEndian.Uint32(rec[90:94]),
+		DataType: rec[94],
+		FileType: rec[95],
+		Flags:    rec[105],
+		Font:     field(rec[106:128]),
+	}
+	for i := range sauce.TInfo {
+		sauce.TInfo[i] = binary.LittleEndian.Uint16(rec[96+2*i:])
+	}
+
+	body = data[:len(data)-sauceSize]
+	if n := int(rec[104]); n > 0 {
+		// comment block: "COMNT" then n lines of 64 characters
+		start := len(body) - 5 - 64*n
+		if start >= 0 && string(body[start:start+5]) == "COMNT" {
+			for i := range n {
+				line := body[start+5+64*i : start+5+64*(i+1)]
+				sauce.Comments = append(sauce.Comments, field(line))
+			}
+			body = body[:start]
+		}
+	}
+	return sauce, body, true
+}
+
+// PlayANS draws ANSI art read from r, sending it at baud bits per second (ten
+// bits to a byte, as with 8N1) to mimic a modem. A baud of 0 draws it as fast
+// as possible. The art goes through Write like anything else, and PlayANS
+// blocks until all of it has been drawn.
+//
+// While playing, the host encoding is CP437 and lines wrap at the width of the
+// art: 80 columns unless the SAUCE record says otherwise. If the terminal is
+// narrower than that, ResizeRequestFunc is asked for more columns. The SAUCE
+// record also sets ICEColors and PropertyFont. The previous settings are
+// restored afterwards.
+func (d *Device) PlayANS(r io.Reader, baud int) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	sauce, data, ok := ParseSAUCE(data)
+	// DOS stops at ^Z; anything after it isn't art
+	if i := bytes.IndexByte(data, 0x1a); i >= 0 {
+		data = data[:i]
+	}
+
+	width := 80
+	if ok && sauce.Columns() > 0 {
+		width = sauce.Columns()
+	}
+
+	// let anything written before take effect under the old settings
+	d.flush()
+	d.Lock()
+	if d.cols < width {
+		d.requestResize(0, width)
+	}
+	cols, enc, ice := d.cols, d.Config.HostEncoding, d.Config.ICEColors
+	d.resize(min(d.cols, width), d.rows)
+	d.Config.HostEncoding = EncodingCP437
+	if ok {
+		d.Config.ICEColors = sauce.ICEColors()
+		if sauce.Font != "" {
+			d.setProperty(PropertyFont, sauce.Font)
+		}
+	}
+	d.configChange()
+	d.Unlock()
+
+	defer func() {
+		d.flush()
+		d.Lock()
+		d.resize(cols, d.rows)
+		d.Config.HostEncoding, d.Config.ICEColors = enc, ice
+		d.configChange()
+		d.Unlock()
+	}()
+
+	chunk, delay := len(data), time.Duration(0)
+	if baud > 0 {
+		// send a chunk every 20ms or so
+		chunk = max(baud/10/50, 1)
+		delay = time.Duration(chunk) * 10 * time.Second / time.Duration(baud)
+	}
+	for len(data) > 0 {
+		n := min(chunk, len(data))
+		d.Write(data[:n])
+		data = data[n:]
+		if delay > 0 && len(data) > 0 {
+			time.Sleep(delay)
+		}
+	}
+	return nil
+}
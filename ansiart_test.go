@@ -0,0 +1,84 @@
+package fansiterm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+// sauceRecord builds a SAUCE record, with a comment block if comments are
+// given.
+func sauceRecord(title string, width uint16, flags byte, font string, comments ...string) []byte {
+	var b bytes.Buffer
+	if len(comments) > 0 {
+		b.WriteString("COMNT")
+		for _, c := range comments {
+			line := make([]byte, 64)
+			copy(line, c)
+			b.Write(bytes.ReplaceAll(line, []byte{0}, []byte{' '}))
+		}
+	}
+	rec := make([]byte, sauceSize)
+	copy(rec, "SAUCE00")
+	copy(rec[7:42], title)
+	copy(rec[82:90], "19960101")
+	rec[94], rec[95] = 1, 1 // character, ANSi
+	binary.LittleEndian.PutUint16(rec[96:], width)
+	binary.LittleEndian.PutUint16(rec[98:], 25)
+	rec[104] = byte(len(comments))
+	rec[105] = flags
+	copy(rec[106:], font)
+	b.Write(rec)
+	return b.Bytes()
+}
+
+func TestParseSAUCE(t *testing.T) {
+	art := []byte("\x1b[1;31mhello\x1a")
+	data := append(slices.Clone(art), sauceRecord("Title", 132, 1, "IBM VGA", "first", "second")...)
+
+	sauce, body, ok := ParseSAUCE(data)
+	if !ok {
+		t.Fatal("no SAUCE record found")
+	}
+	if !bytes.Equal(body, art) {
+		t.Errorf("body = %q, want %q", body, art)
+	}
+	if sauce.Title != "Title" || sauce.Date != "19960101" || sauce.Font != "IBM VGA" {
+		t.Errorf("got title %q, date %q, font %q", sauce.Title, sauce.Date, sauce.Font)
+	}
+	if sauce.Columns() != 132 || !sauce.ICEColors() {
+		t.Errorf("Columns = %d, ICEColors = %v", sauce.Columns(), sauce.ICEColors())
+	}
+	if !slices.Equal(sauce.Comments, []string{"first", "second"}) {
+		t.Errorf("Comments = %q", sauce.Comments)
+	}
+
+	// no record, or one too short to be one
+	for _, data := range [][]byte{art, []byte("SAUCE")} {
+		if _, body, ok := ParseSAUCE(data); ok || !bytes.Equal(body, data) {
+			t.Errorf("ParseSAUCE(%q) = %q, %v", data, body, ok)
+		}
+	}
+}
+
+func TestPlayANS(t *testing.T) {
+	d := New(100, 4, nil)
+	d.write([]byte("\x1b[2;3r\x1b[100G"))
+
+	art := append([]byte("\x1b[5m\x1b[49m"), sauceRecord("", 40, 1, "")...)
+	if err := d.PlayANS(bytes.NewReader(art), 0); err != nil {
+		t.Fatal(err)
+	}
+	if d.attr.Bg != ColorANSI(8) {
+		t.Errorf("iCE colors didn't brighten the default background: %v", d.attr.Bg)
+	}
+
+	if d.cols != 100 || d.Config.ICEColors || d.Config.HostEncoding != EncodingUTF8 {
+		t.Errorf("settings not restored: cols %d, iCE %v, encoding %v",
+			d.cols, d.Config.ICEColors, d.Config.HostEncoding)
+	}
+	if d.scrollRegion != [2]int{0, 3} || d.cursor.col >= 40 {
+		t.Errorf("width change didn't go through resize: region %v, column %d", d.scrollRegion, d.cursor.col)
+	}
+}
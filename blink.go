@@ -0,0 +1,170 @@
+package fansiterm
+
+import (
+	"image"
+	"slices"
+
+	"github.com/sparques/fansiterm/tiles"
+)
+
+// blink.go implements blinking text. There is no cell buffer to redraw the
+// screen from, so every cell drawn with SGR 5 or 6 set is recorded along with
+// what's needed to draw it again. The tick queueHandler then redraws just those
+// cells, alternating between the glyph and a blank.
+//
+// With the notick build tag nothing calls blinkTick and blinking text is
+// simply drawn once, as before.
+
+type blinkState struct {
+	// cells is keyed by column and row.
+	cells map[image.Point]blinkCell
+	// phase counts ticks. Rapid blinking text toggles every tick, slow
+	// blinking text and the cursor every other tick.
+	phase int
+}
+
+type blinkCell struct {
+	cluster []rune
+	attr    Attr
+	fg, bg  Color
+	tileSet *tiles.Tiler
+}
+
+// trackBlink updates the record for the cell under the cursor after cluster
+// has been drawn there.
+func (d *Device) trackBlink(cluster []rune) {
+	pt := image.Pt(d.cursor.col, d.cursor.row)
+	if (!d.attr.Blink && !d.attr.RapidBlink) || d.Config.ICEColors {
+		delete(d.blink.cells, pt)
+		return
+	}
+	if d.blink.cells == nil {
+		d.blink.cells = make(map[image.Point]blinkCell)
+	}
+	d.blink.cells[pt] = blinkCell{
+		cluster: slices.Clone(cluster),
+		attr:    d.attr,
+		fg:      d.Render.active.fg,
+		bg:      d.Render.active.bg,
+		tileSet: d.Render.active.tileSet,
+	}
+}
+
+// clearBlink forgets the blinking cells in the given region, which is in
+// the same units as Clear.
+func (d *Device) clearBlink(x1, y1, x2, y2 int) {
+	region := image.Rect(x1, y1, x2, y2)
+	for pt := range d.blink.cells {
+		if pt.In(region) {
+			delete(d.blink.cells, pt)
+		}
+	}
+}
+
+// scrollBlink moves the blinking cells in rows top through bottom up by
+// amount rows (down if negative), forgetting those that leave.
+func (d *Device) scrollBlink(top, bottom, amount int) {
+	if len(d.blink.cells) == 0 {
+		return
+	}
+	moved := make(map[image.Point]blinkCell, len(d.blink.cells))
+	for pt, cell := range d.blink.cells {
+		if pt.Y >= top && pt.Y <= bottom {
+			pt.Y -= amount
+			if pt.Y < top || pt.Y > bottom {
+				continue
+			}
+		}
+		moved[pt] = cell
+	}
+	d.blink.cells = moved
+}
+
+// shiftBlink moves the blinking cells in row from column col onwards right
+// by amount columns (left if negative), as ICH and DCH do, forgetting those
+// that are deleted or pushed off the end of the line.
+func (d *Device) shiftBlink(row, col, amount int) {
+	if len(d.blink.cells) == 0 {
+		return
+	}
+	moved := make(map[image.Point]blinkCell, len(d.blink.cells))
+	for pt, cell := range d.blink.cells {
+		if pt.Y == row && pt.X >= col {
+			pt.X += amount
+			if pt.X < col || pt.X >= d.cols {
+				continue
+			}
+		}
+		moved[pt] = cell
+	}
+	d.blink.cells = moved
+}
+
+// drawBlinkCell redraws a blinking cell, with its glyph if on is set or a
+// blank otherwise. Underlines and other decorations are kept either way.
+func (d *Device) drawBlinkCell(pt image.Point, cell blinkCell, on bool) {
+	attr, active := d.attr, d.Render.active
+	col, row := d.cursor.col, d.cursor.row
+
+	d.attr = cell.attr
+	d.Render.active.fg, d.Render.active.bg = cell.fg, cell.bg
+	d.Render.active.tileSet = cell.tileSet
+	d.cursor.col, d.cursor.row = pt.X, pt.Y
+	if on {
+		d.renderCluster(cell.cluster)
+	} else {
+		for range clusterWidth(cell.cluster) {
+			d.renderCluster([]rune{' '})
+			d.cursor.col++
+		}
+	}
+
+	d.attr, d.Render.active = attr, active
+	d.cursor.col, d.cursor.row = col, row
+}
+
+// blinkTick is called four times a second by the tick queueHandler. It
+// toggles the cursor and blinking text and calls DisplayFunc once if anything
+// changed.
+func (d *Device) blinkTick() {
+	d.Lock()
+	defer d.Unlock()
+
+	d.blink.phase++
+	slow := d.blink.phase%2 == 0
+	cursor := d.cursor.visible
+	if slow && d.cursor.show && !d.tek.active {
+		cursor = !cursor
+	}
+
+	var changed bool
+	for pt, cell := range d.blink.cells {
+		if pt.X >= d.cols || pt.Y >= d.rows {
+			delete(d.blink.cells, pt)
+			continue
+		}
+		var on bool
+		switch {
+		case cell.attr.RapidBlink:
+			on = d.blink.phase%2 == 0
+		case slow:
+			on = d.blink.phase%4 == 0
+		default:
+			continue
+		}
+		if !changed {
+			// the cursor may be sitting on a blinking cell
+			d.hideCursor()
+			changed = true
+		}
+		d.drawBlinkCell(pt, cell, on)
+	}
+
+	if d.cursor.visible != cursor {
+		d.toggleCursor()
+		changed = true
+	}
+	if changed && d.Render.DisplayFunc != nil {
+		d.Render.DisplayFunc()
+	}
+}
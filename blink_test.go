@@ -0,0 +1,49 @@
+package fansiterm
+
+import (
+	"image"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func blinkCells(d *Device) []image.Point {
+	return slices.SortedFunc(maps.Keys(d.blink.cells), func(a, b image.Point) int {
+		if a.Y != b.Y {
+			return a.Y - b.Y
+		}
+		return a.X - b.X
+	})
+}
+
+func TestBlinkInsertDelete(t *testing.T) {
+	d := New(10, 4, nil)
+	d.write([]byte("ab\x1b[5mcd\x1b[m"))
+
+	d.write([]byte("\x1b[1;2H\x1b[2@"))
+	if got, want := blinkCells(d), []image.Point{{4, 0}, {5, 0}}; !slices.Equal(got, want) {
+		t.Errorf("after ICH: %v, want %v", got, want)
+	}
+
+	d.write([]byte("\x1b[3P"))
+	if got, want := blinkCells(d), []image.Point{{1, 0}, {2, 0}}; !slices.Equal(got, want) {
+		t.Errorf("after DCH: %v, want %v", got, want)
+	}
+}
+
+func TestBlinkAltScreen(t *testing.T) {
+	d := New(10, 4, nil)
+	d.Config.AltScreen = true
+	d.write([]byte("\x1b[5ma\x1b[m"))
+
+	d.write([]byte("\x1b[?1049h"))
+	if len(d.blink.cells) != 0 {
+		t.Errorf("main screen cells blinking on the alternate screen: %v", blinkCells(d))
+	}
+	d.write([]byte("\x1b[5mb\x1b[m"))
+
+	d.write([]byte("\x1b[?1049l"))
+	if got, want := blinkCells(d), []image.Point{{0, 0}}; !slices.Equal(got, want) {
+		t.Errorf("back on the main screen: %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package fansiterm
+
+import "io"
+
+// c1.go handles the 8-bit C1 control characters, 0x80 through 0x9F. Each is
+// equivalent to ESC followed by the character 0x40 lower, e.g. 0x9B is CSI,
+// ESC [. Incoming C1 controls are rewritten to their 7-bit form before
+// parsing. S8C1T (ESC SP G) makes replies use the 8-bit form as well.
+//
+// In UTF-8, C1 controls are the code points U+0080-U+009F. Raw 8-bit bytes
+// only get this far with EncodingLatin1, or if Config.InvalidUTF8 is
+// UTF8Latin1.
+
+func isC1(r rune) bool {
+	return r >= 0x80 && r <= 0x9F
+}
+
+// expandC1 replaces any C1 controls in runes with their 7-bit equivalents,
+// or drops them if disabled is set.
+func expandC1(runes []rune, disabled bool) []rune {
+	n := 0
+	for _, r := range runes {
+		if isC1(r) {
+			n++
+		}
+	}
+	if n == 0 {
+		return runes
+	}
+	expanded := make([]rune, 0, len(runes)+n)
+	for _, r := range runes {
+		switch {
+		case isC1(r) && disabled:
+			continue
+		case isC1(r):
+			expanded = append(expanded, 0x1b, r-0x40)
+			continue
+		}
+		expanded = append(expanded, r)
+	}
+	return expanded
+}
+
+// output returns the writer replies should go to: Output itself, or Output
+// wrapped to send 8-bit controls after S8C1T.
+func (d *Device) output() io.Writer {
+	if d.c1Replies {
+		return c1Writer{d.Output}
+	}
+	return d.Output
+}
+
+// c1Writer converts 7-bit escape sequence introducers written to it, such as
+// ESC [, into their single byte C1 forms.
+type c1Writer struct {
+	io.Writer
+}
+
+func (w c1Writer) Write(p []byte) (n int, err error) {
+	buf := make([]byte, 0, len(p))
+	for i := 0; i < len(p); i++ {
+		if p[i] == 0x1b && i+1 < len(p) && p[i+1] >= 0x40 && p[i+1] <= 0x5F {
+			buf = append(buf, p[i+1]+0x40)
+			i++
+			continue
+		}
+		buf = append(buf, p[i])
+	}
+	if _, err = w.Writer.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
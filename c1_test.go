@@ -0,0 +1,76 @@
+package fansiterm
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestExpandC1(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		disabled bool
+		want     string
+	}{
+		{"none", "abc", false, "abc"},
+		{"csi", "\u009b5A", false, "\x1b[5A"},
+		{"osc and st", "\u009d0;t\u009c", false, "\x1b]0;t\x1b\\"},
+		{"edges", "\u0080\u009f", false, "\x1b@\x1b_"},
+		{"not c1", "\u007f ", false, "\u007f "},
+		{"disabled", "a\u009b5Ab", true, "a5Ab"},
+	}
+	for _, tt := range tests {
+		got := expandC1([]rune(tt.in), tt.disabled)
+		if !slices.Equal(got, []rune(tt.want)) {
+			t.Errorf("%s: got %q, want %q", tt.name, string(got), tt.want)
+		}
+	}
+}
+
+func TestC1Input(t *testing.T) {
+	d := New(10, 4, nil)
+	d.write([]byte("\u009b3C"))
+	if d.cursor.col != 3 {
+		t.Errorf("8-bit CSI: column %d, want 3", d.cursor.col)
+	}
+
+	d.Config.DisableC1 = true
+	d.write([]byte("\u009b3C"))
+	if d.cursor.col != 5 {
+		t.Errorf("disabled 8-bit CSI: column %d, want 5 (the 3 and C printed)", d.cursor.col)
+	}
+}
+
+func TestC1Writer(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"\x1b[?1;2c", "\x9b?1;2c"},
+		{"\x1b]0;t\x1b\\", "\x9d0;t\x9c"},
+		{"\x1bP1$r0m\x1b\\", "\x901$r0m\x9c"},
+		// only ESC followed by 0x40-0x5F has a C1 form
+		{"\x1bc\x1b7", "\x1bc\x1b7"},
+		{"text\x1b", "text\x1b"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		n, err := c1Writer{&out}.Write([]byte(tt.in))
+		if err != nil || n != len(tt.in) {
+			t.Errorf("Write(%q) = %d, %v", tt.in, n, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("Write(%q) wrote %q, want %q", tt.in, out.String(), tt.want)
+		}
+	}
+}
+
+func TestS8C1T(t *testing.T) {
+	d := New(10, 4, nil)
+	var out bytes.Buffer
+	d.Output = &out
+	d.write([]byte("\x1b G\x1b[c\x1b F\x1b[c"))
+	if got, want := out.String(), "\x9b?1;2;4c\x1b[?1;2;4c"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
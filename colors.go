@@ -67,3 +67,14 @@ func (c Colorizer) RGBA() (r, g, b, a uint32) {
 	v := c()
 	return uint32(v.R), uint32(v.G), uint32(v.B), uint32(v.A)
 }
+
+// blendColor mixes a toward b; weight is how much of b to use, out of 256.
+// It's used for faint text.
+func blendColor(a, b Color, weight uint32) Color {
+	ar, ag, ab, _ := a.RGBA()
+	br, bg, bb, _ := b.RGBA()
+	mix := func(x, y uint32) uint8 {
+		return uint8(((x*(256-weight) + y*weight) / 256) >> 8)
+	}
+	return NewOpaqueColor(mix(ar, br), mix(ag, bg), mix(ab, bb))
+}
@@ -1,5 +1,7 @@
 package fansiterm
 
+import "time"
+
 // Config defines runtime settings for a Device.
 type Config struct {
 	LocalEcho                bool
@@ -8,10 +10,58 @@ type Config struct {
 	CursorStyle              int  // Default cursor style.
 	BoldColors               bool // Whether bold colors are enabled.
 	AltScreen                bool // Enable alternate screen buffer (expensive on MCUs).
-	Wraparound               bool // Whether text wraps at the screen edge.
+	Wraparound               bool // Whether text wraps at the screen edge (DECAWM).
 	CursorKeyApplicationMode bool // Enable application mode for cursor keys.
-	MouseEvents              int  // 0, 1000, 10002, or 1003
+	KeypadApplicationMode    bool // Numeric keypad sends SS3 sequences (ESC =) rather than digits (ESC >).
+	MouseEvents              int  // 0, 9, 1000, 1002, or 1003
 	MouseSGR                 bool // if false, use \e[Mcbxbyb reporting; else use \e[<
+	MouseUTF8                bool // \e[Mcbxbyb, with the coordinates in UTF-8 (1005).
+	MouseURXVT               bool // \e[cb;x;yM (1015).
+	MouseSGRPixels           bool // As MouseSGR, but x and y are in pixels (1016).
+	FocusEvents              bool // Focus sends \e[I and \e[O (1004).
+	BracketedPaste           bool // Paste wraps text in \e[200~ and \e[201~ (2004).
+	SixelScrolling           bool // Sixel images are drawn at the cursor and scroll the screen (DECSDM reset).
+
+	// ReportTitles allows CSI 20 t and CSI 21 t to send the icon name and
+	// window title back to the host. This is off by default: anything that
+	// can set the title can then make the terminal "type" it.
+	ReportTitles bool
+
+	// ModifyOtherKeys is the xterm modifyOtherKeys level set with
+	// CSI > 4 ; n m. At 1, modified keys that would otherwise send the same
+	// thing as some other key, such as Ctrl+Shift+A, are sent as
+	// CSI 27 ; mod ; code ~. At 2, all modified keys are.
+	ModifyOtherKeys int
+
+	// HostEncoding is the character encoding of the bytes written to the
+	// Device. ESC % G and ESC % @ switch it to UTF-8 and ISO-8859-1.
+	HostEncoding HostEncoding
+
+	// ICEColors makes SGR 5 select a bright background instead of blinking,
+	// as ANSI art drawn with iCE colors expects.
+	ICEColors bool
+
+	// InvalidUTF8 is what to do with bytes that aren't valid UTF-8. The
+	// default is to replace them with U+FFFD.
+	InvalidUTF8 UTF8Policy
+
+	// DisableC1 turns off recognition of the 8-bit C1 controls (0x80-0x9F);
+	// they're dropped instead. Hosts that send UTF-8 text never mean them.
+	DisableC1 bool
+
+	// MaxSequenceLength is the longest, in bytes, an OSC, APC, DCS or
+	// fansiterm private sequence may get. The rest of a longer one is
+	// discarded up to its terminator, and the sequence is ignored. Images
+	// are sent this way (sixels, ESC / B blits, iTerm2 inline images), so
+	// the default leaves room for sizeable ones; on a microcontroller it
+	// should be lowered to well under the available memory. Kitty graphics
+	// only needs 4096 bytes, as it is sent in chunks. Zero means no limit.
+	MaxSequenceLength int
+
+	// SequenceTimeout, if non-zero, is how long an incomplete escape
+	// sequence may wait for the rest of it before it is thrown away. It's
+	// checked when the next Write comes along.
+	SequenceTimeout time.Duration
 
 	// Miscellaneous properties, like "Window Title"
 	Properties map[Property]string
@@ -22,6 +72,9 @@ var ConfigDefault = Config{
 	TabSize:             8,
 	StrikethroughHeight: 7,
 	BoldColors:          true,
+	Wraparound:          true,
+	MaxSequenceLength:   1 << 18,
+	SixelScrolling:      true,
 }
 
 func NewConfig() Config {
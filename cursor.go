@@ -33,7 +33,8 @@ func (c *Cursor) ColsRemaining() int {
 }
 
 func (c *Cursor) MoveRel(x, y int) {
-	c.col = bound(x+c.col, 0, *c.cols-1)
+	// col is one past the last column when a wrap is pending
+	c.col = bound(x+min(c.col, *c.cols-1), 0, *c.cols-1)
 	c.row = bound(y+c.row, 0, *c.rows-1)
 }
 
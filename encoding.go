@@ -0,0 +1,102 @@
+package fansiterm
+
+// encoding.go turns the bytes written to a Device into runes, according to
+// the host's character encoding. ESC % G (DOCS) switches to UTF-8 and ESC % @
+// back to ISO-8859-1.
+
+// HostEncoding is the character encoding of the bytes written to a Device.
+type HostEncoding int
+
+const (
+	// EncodingUTF8 is the default. Invalid bytes are handled according to
+	// Config.InvalidUTF8.
+	EncodingUTF8 HostEncoding = iota
+	// EncodingLatin1 is ISO-8859-1: every byte is the code point of the same
+	// value, so 0x80-0x9F are the C1 controls.
+	EncodingLatin1
+	// EncodingCP437 is the IBM PC character set, as used by DOS and BBSes.
+	// The control characters the terminal acts on (BEL, BS, HT, LF, VT, FF,
+	// CR, SO, SI, CAN, SUB and ESC) stay controls; the other bytes are drawn
+	// as the PC glyphs, including smileys and card suits for the rest of
+	// 0x00-0x1F. The box drawing and block characters are in the built-in
+	// tiles; the rest need a tile set that has them.
+	EncodingCP437
+)
+
+// cp437 maps each CP437 byte to Unicode.
+var cp437 = []rune("" +
+	"\u0000☺☻♥♦♣♠•◘○◙♂♀♪♫☼►◄↕‼¶§▬↨↑↓→←∟↔▲▼" +
+	" !\"#$%&'()*+,-./0123456789:;<=>?" +
+	"@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_" +
+	"`abcdefghijklmnopqrstuvwxyz{|}~⌂" +
+	"ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜ¢£¥₧ƒ" +
+	"áíóúñÑªº¿⌐¬½¼¡«»░▒▓│┤╡╢╖╕╣║╗╝╜╛┐" +
+	"└┴┬├─┼╞╟╚╔╩╦╠═╬╧╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀" +
+	"αßΓπΣσµτΦΘΩδ∞φε∩≡±≥≤⌠⌡÷≈°∙·√ⁿ²■ ")
+
+// decode turns data into runes using the host encoding. An ESC % sequence
+// changes the encoding from that point on; handleEscSequence records the
+// change in Config when it gets to it. An ESC or ESC % at the end of data is
+// kept in docsBuf, already decoded, so that a sequence split between writes
+// still switches the encoding.
+func (d *Device) decode(data []byte) []rune {
+	enc := d.Config.HostEncoding
+	buf := data
+	// done is how much of buf is already decoded
+	done := len(d.docsBuf)
+	if done > 0 {
+		buf = append(d.docsBuf, data...)
+		d.docsBuf = nil
+	}
+
+	var runes []rune
+	for i := 0; i+2 < len(buf); i++ {
+		if buf[i] != 0x1b || buf[i+1] != '%' {
+			continue
+		}
+		next := enc
+		switch buf[i+2] {
+		case 'G':
+			next = EncodingUTF8
+		case '@':
+			next = EncodingLatin1
+		default:
+			continue
+		}
+		runes = append(runes, d.decodeWith(enc, buf[done:i+3])...)
+		done, enc = i+3, next
+		i += 2
+	}
+	runes = append(runes, d.decodeWith(enc, buf[done:])...)
+
+	switch n := len(buf); {
+	case n >= 2 && buf[n-2] == 0x1b && buf[n-1] == '%':
+		d.docsBuf = []byte{0x1b, '%'}
+	case n >= 1 && buf[n-1] == 0x1b:
+		d.docsBuf = []byte{0x1b}
+	}
+	return runes
+}
+
+// decodeWith decodes data in a particular encoding.
+func (d *Device) decodeWith(enc HostEncoding, data []byte) []rune {
+	if enc == EncodingUTF8 {
+		return d.decodeUTF8(data)
+	}
+	// a UTF-8 sequence cut off by a switch away from UTF-8 is never going
+	// to be finished
+	d.utf8Buf = nil
+
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		switch {
+		case enc != EncodingCP437:
+			runes[i] = rune(b)
+		case b >= '\a' && b <= '\r', b == 0x0e, b == 0x0f, b == 0x18, b == 0x1a, b == 0x1b:
+			runes[i] = rune(b)
+		default:
+			runes[i] = cp437[b]
+		}
+	}
+	return runes
+}
@@ -0,0 +1,36 @@
+package fansiterm
+
+import "testing"
+
+func TestDecodeEncodings(t *testing.T) {
+	tests := []struct {
+		name string
+		enc  HostEncoding
+		// writes are written one after another
+		writes []string
+		want   string
+	}{
+		{"docs latin1", EncodingUTF8, []string{"\x1b%@\xe9"}, "\x1b%@é"},
+		{"docs utf8", EncodingLatin1, []string{"\xe9\x1b%G\xc3\xa9"}, "é\x1b%Gé"},
+		{"docs split after esc", EncodingUTF8, []string{"a\x1b", "%@\xe9"}, "a\x1b%@é"},
+		{"docs split after %", EncodingUTF8, []string{"\x1b%", "@\xe9"}, "\x1b%@é"},
+		{"docs split three ways", EncodingLatin1, []string{"\x1b", "%", "G\xc3\xa9"}, "\x1b%Gé"},
+		{"not docs", EncodingUTF8, []string{"\x1b", "[m\xc3\xa9"}, "\x1b[mé"},
+		{"cp437 glyphs", EncodingCP437, []string{"\x01\x03\xb0\xdb"}, "☺♥░█"},
+		{"cp437 controls", EncodingCP437, []string{"\a\b\t\n\v\f\r\x0e\x0f\x18\x1a\x1b"}, "\a\b\t\n\v\f\r\x0e\x0f\x18\x1a\x1b"},
+	}
+	for _, tt := range tests {
+		d := New(10, 4, nil)
+		d.Config.HostEncoding = tt.enc
+		var got []rune
+		for _, w := range tt.writes {
+			runes := d.decode([]byte(w))
+			got = append(got, runes...)
+			// hand the runes over, so that ESC % changes Config
+			d.parseInput(runes)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, string(got), tt.want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package fansiterm
+
+// handleAPCSequence handles Application Program Commands, ESC _ ... ST. seq
+// is what's between the _ and the ST.
+func (d *Device) handleAPCSequence(seq []rune) {
+	if len(seq) == 0 {
+		return
+	}
+	switch seq[0] {
+	case 'G': // kitty graphics protocol
+		d.handleKittyGraphics(seq[1:])
+	default:
+		if ShowUnhandled {
+			log.Warn("unhandled APC", "sequence", seqString(seq))
+		}
+	}
+}
@@ -4,15 +4,24 @@ import (
 	"fmt"
 	"image"
 	"image/draw"
+	"slices"
+
+	"github.com/sparques/fansiterm/parser"
 )
 
-func (d *Device) handleCSISequence(seq []rune) {
-	if len(seq) == 0 {
+// handleCSISequence handles a control sequence, CSI params inter final.
+// inter has any private marker (< = > ?) first, then the intermediates.
+func (d *Device) handleCSISequence(final byte, params *parser.Params, inter []byte) {
+	if d.customCSI(final, params, inter) {
 		return
 	}
-	args := getNumericArgs(seq[:len(seq)-1], 1)
-	// last byte of seq tells us what function we're doing
-	switch seq[len(seq)-1] {
+	var marker byte
+	if len(inter) > 0 && inter[0] >= '<' && inter[0] <= '?' {
+		marker = inter[0]
+	}
+	args := numericArgs(params, 1)
+	// the final byte tells us what function we're doing
+	switch final {
 	case '@': // // Insert Characters. one option numerica arg, default 1
 		// TODO really shouldn't be using d.Render / d.Render.Image directly in here.
 		// Should have a scroll horizontal function or similar maybe a vectorScroll that works in cells
@@ -21,6 +30,7 @@ func (d *Device) handleCSISequence(seq []rune) {
 		d.Render.VectorScroll(
 			image.Rectangle{Min: curs, Max: curs.Add(image.Pt(d.cursor.ColsRemaining()*d.Render.cell.Dx(), d.Render.cell.Dy()))},
 			image.Pt(-d.Render.cell.Dx()*args[0], 0))
+		d.shiftBlink(d.cursor.row, d.cursor.col, args[0])
 	case 'A': // Cursor Up, one optional numeric arg, default 1
 		d.cursor.MoveRel(0, -args[0])
 	case 'B': // Cursor Down, one optional numeric arg, default 1
@@ -35,6 +45,13 @@ func (d *Device) handleCSISequence(seq []rune) {
 		d.cursor.MoveRel(-d.cols, -args[0])
 	case 'G': // Moves the cursor to column n (default 1).
 		d.cursor.MoveAbs(args[0]-1, d.cursor.row)
+	case 'g': // TBC: tab clear; 0 clears the stop at the cursor, 3 clears them all
+		switch params.Get(0, 0) {
+		case 0:
+			d.setTabStop(false)
+		case 3:
+			d.clearTabStops()
+		}
 	case 'H', 'f': // Cursor position, Moves the cursor to row n, column m. The values are 1-based, and default to 1 (top left corner) if omitted. A sequence such as CSI ;5H is a synonym for CSI 1;5H as well as CSI 17;H is the same as CSI 17H and CSI 17;1H
 		var n, m int = 1, 1
 		switch len(args) {
@@ -47,11 +64,12 @@ func (d *Device) handleCSISequence(seq []rune) {
 
 		d.cursor.MoveAbs(m-1, n-1)
 	case 'J': // Clears part of the screen. If n is 0 (or missing), clear from cursor to end of screen. If n is 1, clear from cursor to beginning of the screen. If n is 2, clear entire screen (and moves cursor to upper left on DOS ANSI.SYS). If n is 3, clear entire screen and delete all lines saved in the scrollback buffer (this feature was added for xterm and is supported by other terminal applications).
-		args = getNumericArgs(seq[:len(seq)-1], 0)
+		args = numericArgs(params, 0)
 		switch args[0] {
 		case 0:
-			// clear from cursor to EOL
-			d.Clear(d.cursor.col, d.cursor.row, d.cols, d.cursor.row+1)
+			// clear from cursor to EOL; with a wrap pending, the cursor is
+			// still on the last column
+			d.Clear(min(d.cursor.col, d.cols-1), d.cursor.row, d.cols, d.cursor.row+1)
 			// clear area below cursor
 			d.Clear(0, d.cursor.row+1, d.cols, d.rows)
 		case 1:
@@ -65,11 +83,12 @@ func (d *Device) handleCSISequence(seq []rune) {
 		}
 
 	case 'K': // Erases part of the line. If n is 0 (or missing), clear from cursor to the end of the line. If n is 1, clear from cursor to beginning of the line. If n is 2, clear entire line. Cursor position does not change.
-		args = getNumericArgs(seq[:len(seq)-1], 0)
+		args = numericArgs(params, 0)
 		switch args[0] {
 		case 0:
-			// clear from cursor to EOL
-			d.Clear(d.cursor.col, d.cursor.row, d.cols, d.cursor.row+1)
+			// clear from cursor to EOL, which includes the last column
+			// when a wrap is pending
+			d.Clear(min(d.cursor.col, d.cols-1), d.cursor.row, d.cols, d.cursor.row+1)
 		case 1:
 			// clear from cursor to beginning of line
 			d.Clear(0, d.cursor.row, d.cursor.col, d.cursor.row+1)
@@ -102,6 +121,7 @@ func (d *Device) handleCSISequence(seq []rune) {
 		d.Render.VectorScroll(
 			image.Rectangle{Min: curs, Max: curs.Add(image.Pt(d.cursor.ColsRemaining()*d.Render.cell.Dx(), d.Render.cell.Dy()))},
 			image.Pt(d.Render.cell.Dx()*args[0], 0))
+		d.shiftBlink(d.cursor.row, d.cursor.col, -args[0])
 		d.Clear(d.cols-args[0], d.cursor.row, d.cols, d.cursor.row+1)
 
 	case 'S': // Scroll whole page up by n (default 1) lines. New lines are added at the bottom.
@@ -111,172 +131,73 @@ func (d *Device) handleCSISequence(seq []rune) {
 	case 'X': // Delete (clear) cells to the right of the cursor, on the same line
 		d.Clear(d.cursor.col, d.cursor.row, bound(args[0]+d.cursor.col, d.cursor.col+1, d.cols), d.cursor.row+1)
 	case 'c': // DA Device Attributes
-		// Lie and say we're a vt100
-		fmt.Fprintf(d.Output, "\x1b[?1;2c")
+		// Lie and say we're a vt100, one that can do sixels
+		fmt.Fprintf(d.output(), "\x1b[?1;2;4c")
 	case 'd': // CSI n d: Mover cursor to line n
-		args = getNumericArgs(seq[:len(seq)-1], 1)
+		args = numericArgs(params, 1)
 		d.cursor.row = bound(args[0]-1, 0, d.rows)
 	case 'm': // CoLoRs!1!! AKA SGR (Select Graphic Rendition)
-		args := getNumericArgs(seq[:len(seq)-1], 0)
-		for i := 0; i < len(args); i++ {
-			switch args[i] {
-			case 0:
-				d.attr = d.attrDefault
-			case 1:
-				d.attr.Bold = true
-				if d.Config.BoldColors {
-					// if BoldColors is enabled, setting bold bumps
-					// the fg color
-					for i := range 8 {
-						if d.attr.Fg == ColorANSI(i) {
-							d.attr.Fg = ColorANSI(i + 8)
-							break
-						}
-					}
-					// don't modify color if we're not using one of the
-					// vga colors. There is a corner case of someone using
-					// a 24-bit or 256-color color, fixible by using a flag
-					// indicating if we've set a ANSI color or not, but...
-					// meh.
-				}
-			case 22:
-				d.attr.Bold = false
-				if d.Config.BoldColors {
-					// if BoldColors is enabled, unsetting bold drops
-					// the fg color
-					for i := range 8 {
-						if d.attr.Fg == ColorANSI(i+8) {
-							d.attr.Fg = ColorANSI(i)
-							break
-						}
-					}
-					// don't modify color if we're not using one of the
-					// vga colors. There is a corner case of someone using
-					// a 24-bit or 256-color color, fixible by using a flag
-					// indicating if we've set a ANSI color or not, but...
-					// meh.
-				}
-			case 3:
-				d.attr.Italic = true
-			case 23:
-				d.attr.Italic = false
-			case 4:
-				d.attr.Underline = true
-			case 21:
-				d.attr.Underline = true
-				d.attr.DoubleUnderline = true
-			case 24:
-				d.attr.Underline = false
-				d.attr.DoubleUnderline = false
-			case 5:
-				d.attr.Blink = true
-			case 25:
-				d.attr.Blink = false
-			case 7:
-				d.attr.Reversed = true
-			case 27:
-				d.attr.Reversed = false
-			case 8:
-				d.attr.Conceal = true
-			case 28:
-				d.attr.Conceal = false
-			case 9:
-				d.attr.Strike = true
-			// case 10:
-			// 	d.Render.active.tileSet = d.Render.G0
-			// case 11:
-			// 	d.Render.active.tileSet = d.Render.G1
-			case 29:
-				d.attr.Strike = false
-			case 30, 31, 32, 33, 34, 35, 36, 37:
-				if d.Config.BoldColors && d.attr.Bold {
-					d.attr.Fg = ColorANSI(args[i] - 30 + 8)
-				} else {
-					d.attr.Fg = ColorANSI(args[i] - 30)
-				}
-			case 39:
-				d.attr.Fg = d.attrDefault.Fg
-			case 40, 41, 42, 43, 44, 45, 46, 47:
-				d.attr.Bg = ColorANSI(args[i] - 40)
-			case 49:
-				d.attr.Bg = d.attrDefault.Bg
-			case 90, 91, 92, 93, 94, 95, 96, 97:
-				d.attr.Fg = ColorANSI(args[i] - 90 + 8)
-			case 100, 101, 102, 103, 104, 105, 106, 107:
-				d.attr.Bg = ColorANSI(args[i] - 100 + 8)
-			// 24bit True Color and 256-Color support support
-			case 38, 48:
-				if i+1 >= len(args) {
-					continue
-				}
-				if args[i+1] == 5 {
-					// prevent going out of range
-					args[i] = args[i] % 256
-					if args[i] == 38 {
-						d.attr.Fg = Color256(args[i+2])
-					} else {
-						d.attr.Bg = Color256(args[i+2])
-					}
-					i += 2
-					continue
+		if marker == '>' {
+			// XTMODKEYS: CSI > 4 ; n m sets modifyOtherKeys; the other
+			// resources aren't configurable
+			args = numericArgs(params, 0)
+			if args[0] == 4 {
+				d.Config.ModifyOtherKeys = 0
+				if len(args) > 1 {
+					d.Config.ModifyOtherKeys = args[1]
 				}
-				if args[i+1] != 2 {
-					continue
-				}
-				i += 2
-				// can proceed
-				var r, g, b uint8
-				r, g, b = getRGB(args[i:])
-				i += 2
-				if args[i-4] == 38 {
-					d.attr.Fg = NewOpaqueColor(r, g, b)
-				} else {
-					d.attr.Bg = NewOpaqueColor(r, g, b)
-				}
-			default:
-				if ShowUnhandled {
-					log.Warn("unhandled SGR", "unhandled", args[i], "from", seqString(seq))
-				}
-
-			} // switch for SGR
-
+				d.configChange()
+			}
+			return
 		}
+		d.handleSGR(params)
 	case 'n': // DSR - Device Status Report
+		if marker == '>' {
+			// CSI > 4 n turns modifyOtherKeys off
+			if params.Get(0, 0) == 4 {
+				d.Config.ModifyOtherKeys = 0
+				d.configChange()
+			}
+			return
+		}
 		// args -
 		// '5' just returns CSI 0 n
 		// '6' return cursor location
 		switch args[0] {
 		case 5:
-			d.Output.Write([]byte{0x1b, '[', '0', 'n'})
+			d.output().Write([]byte{0x1b, '[', '0', 'n'})
 		case 6:
-			fmt.Fprintf(d.Output, "\x1b[%d;%dR", bound(d.cursor.row+1, 1, d.rows), bound(d.cursor.col+1, 1, d.cols))
+			fmt.Fprintf(d.output(), "\x1b[%d;%dR", bound(d.cursor.row+1, 1, d.rows), bound(d.cursor.col+1, 1, d.cols))
 		}
 	case 'l', 'h': // private on/off extensions
-		if seq[0] != '?' || len(seq) < 2 {
+		if marker != '?' {
 			return
 		}
-		args := getNumericArgs(seq[1:len(seq)-1], 0)
-		var set bool
-		if seq[len(seq)-1] == 'h' {
-			set = true
-		}
+		args := numericArgs(params, 0)
+		set := final == 'h'
 		switch args[0] {
 		case 0, 1: // cursor key mode
 			// enable: Application Mode
 			// disable: Cursor Mode.
-			// This is more an input thing--whatever is writing to fansiterm
-			// should check this setting and adjust arrow-key input
-			// accordingly.ESC?12h
+			// This is more an input thing; EncodeKey and SendKey take it
+			// into account.
 			d.Config.CursorKeyApplicationMode = set
 			d.configChange()
+		case 2: // DECANM; reset switches to VT52 mode
+			d.vt52 = !set
+			d.configChange()
 		case 7: // enable/disable wraparound mode.
 			// my god, getting end of line and end of terminal line wrapping
 			// working the first place was hard enough.
 			// wraparound is the process of if a line over flows (reaches EOL) it should continue onto the next line. With wrap around disabled, once the cursor gets to the end of the line, it no longer advances.
-			d.Config.Wraparound = !set
+			d.Config.Wraparound = set
 			d.configChange()
 		case 9: //legacy mouse support
-			d.Config.MouseEvents = 9
+			if set {
+				d.Config.MouseEvents = 9
+			} else {
+				d.Config.MouseEvents = 0
+			}
 			d.configChange()
 		case 12: // local echo
 			d.Config.LocalEcho = set
@@ -290,6 +211,15 @@ func (d *Device) handleCSISequence(seq []rune) {
 					d.toggleCursor()
 				}
 			}
+		case 38: // Tektronix 4014 mode
+			if set {
+				d.enterTek()
+			} else {
+				d.exitTek()
+			}
+		case 80: // DECSDM sixel display mode; set disables sixel scrolling
+			d.Config.SixelScrolling = !set
+			d.configChange()
 		case 1000, 1002, 1003: // enable/disable mouse even reports
 			if set {
 				d.Config.MouseEvents = args[0]
@@ -297,9 +227,18 @@ func (d *Device) handleCSISequence(seq []rune) {
 				d.Config.MouseEvents = 0
 			}
 			d.configChange()
+		case 1005:
+			d.Config.MouseUTF8 = set
+			d.configChange()
 		case 1006:
 			d.Config.MouseSGR = set
 			d.configChange()
+		case 1015:
+			d.Config.MouseURXVT = set
+			d.configChange()
+		case 1016:
+			d.Config.MouseSGRPixels = set
+			d.configChange()
 		// no, not supported
 		case 47, 1049: // alt screen enable/disable
 			// 47 is save/restore screen.
@@ -313,17 +252,25 @@ func (d *Device) handleCSISequence(seq []rune) {
 				// use AltScreen; just save the buffer
 				d.saveBuf = image.NewRGBA(d.Render.bounds)
 				draw.Draw(d.saveBuf, d.Render.bounds, d.Render, d.Render.bounds.Min, draw.Src)
+				d.saveBlink = d.blink.cells
+				d.saveKeyFlags, d.keyFlagStack = d.keyFlagStack, nil
 				d.clearAll()
 			} else {
 				// stop using alt screen, show the saved buffer
 				draw.Draw(d.Render, d.Render.bounds, d.saveBuf, d.Render.bounds.Min, draw.Src)
+				d.blink.cells, d.saveBlink = d.saveBlink, nil
+				d.keyFlagStack, d.saveKeyFlags = d.saveKeyFlags, nil
 			}
 			d.cursor.ToggleAltPos()
+		case 1004: // focus in/out reporting
+			d.Config.FocusEvents = set
+			d.configChange()
 		case 2004: //bracketed paste enable disable
-			// given fansiterm's intended use case, this is going unimplemented.
+			d.Config.BracketedPaste = set
+			d.configChange()
 		default:
 			if ShowUnhandled {
-				log.Warn("unhandled private escape sequence", seqString(seq))
+				log.Warn("unhandled private escape sequence", "sequence", csiString(final, params, inter))
 			}
 		}
 	case 'r': // set scroll region
@@ -333,20 +280,274 @@ func (d *Device) handleCSISequence(seq []rune) {
 		d.setScrollRegion(args[0], args[1])
 	case 's': // save cursor position
 		d.cursor.SavePos()
-	case 't':
+	case 't': // XTWINOPS window operations
+		// missing parameters mean "leave as is" for resizes, so default to 0
+		args = numericArgs(params, 0)
+		for len(args) < 3 {
+			args = append(args, 0)
+		}
 		switch args[0] {
-		case 18: // report terminal size in cells
-			fmt.Fprintf(d.Output, "\x1b[8;%d:%dt", d.rows, d.cols)
-		case 19: // report terminal size in pixels
-			fmt.Fprintf(d.Output, "\x1b[9;%d;%dt", d.Render.Bounds().Dy(), d.Render.Bounds().Dx())
+		case 4: // resize text area to height;width pixels
+			if args[1] != 0 {
+				args[1] /= d.Render.cell.Dy()
+			}
+			if args[2] != 0 {
+				args[2] /= d.Render.cell.Dx()
+			}
+			d.requestResize(args[1], args[2])
+		case 8: // resize text area to height;width cells
+			d.requestResize(args[1], args[2])
+		case 14: // report text area (or with 14;2, the whole window) size in pixels
+			size := d.Render.Bounds().Size()
+			if args[1] == 2 {
+				size = d.Render.Image.Bounds().Size()
+			}
+			fmt.Fprintf(d.output(), "\x1b[4;%d;%dt", size.Y, size.X)
+		case 16: // report cell size in pixels
+			fmt.Fprintf(d.output(), "\x1b[6;%d;%dt", d.Render.cell.Dy(), d.Render.cell.Dx())
+		case 18: // report text area size in cells
+			fmt.Fprintf(d.output(), "\x1b[8;%d;%dt", d.rows, d.cols)
+		case 19: // report screen size in cells
+			screen := d.Render.Image.Bounds().Size()
+			fmt.Fprintf(d.output(), "\x1b[9;%d;%dt", screen.Y/d.Render.cell.Dy(), screen.X/d.Render.cell.Dx())
+		case 20: // report icon name
+			if d.Config.ReportTitles {
+				fmt.Fprintf(d.output(), "\x1b]L%s\x1b\\", d.Config.Properties[PropertyIconName])
+			}
+		case 21: // report window title
+			if d.Config.ReportTitles {
+				fmt.Fprintf(d.output(), "\x1b]l%s\x1b\\", d.Config.Properties[PropertyWindowTitle])
+			}
+		case 22: // push titles onto the title stack
+			d.pushTitle(args[1])
+		case 23: // pop titles from the title stack
+			d.popTitle(args[1])
+		default:
+			if ShowUnhandled {
+				log.Warn("unhandled window operation", "sequence", csiString(final, params, inter))
+			}
+		}
+	case 'u':
+		switch marker {
+		case '>', '<', '=', '?': // kitty keyboard protocol
+			d.handleKeyFlags(marker, params)
+		default: // restore cursor position
+			d.cursor.RestorePos()
 		}
-	case 'u': // restore cursor position
-		d.cursor.RestorePos()
 	default:
 		if ShowUnhandled {
-			log.Warn("unhandled CSI", "sequence", seqString(seq))
+			log.Warn("unhandled CSI", "sequence", csiString(final, params, inter))
 		}
-	} // switch seq[len(seq)-1]
+	} // switch final
 }
 
 var cur [2]int
+
+// setUnderlineStyle applies SGR 4:style. 0 is no underline, 1 single, 2
+// double, 3 curly, 4 dotted and 5 dashed.
+func (d *Device) setUnderlineStyle(style int) {
+	d.attr.Underline = style > 0 && style <= 5
+	d.attr.DoubleUnderline = style == 2
+	d.attr.UnderlineStyle = UnderlineStraight
+	if style >= 3 && style <= 5 {
+		d.attr.UnderlineStyle = UnderlineStyle(style - 2)
+	}
+}
+
+// handleSGR handles Select Graphic Rendition, CSI ... m.
+func (d *Device) handleSGR(params *parser.Params) {
+	args := numericArgs(params, 0)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case 0:
+			d.attr = d.attrDefault
+		case 1:
+			d.attr.Bold = true
+			if d.Config.BoldColors {
+				// if BoldColors is enabled, setting bold bumps
+				// the fg color
+				for i := range 8 {
+					if d.attr.Fg == ColorANSI(i) {
+						d.attr.Fg = ColorANSI(i + 8)
+						break
+					}
+				}
+				// don't modify color if we're not using one of the
+				// vga colors. There is a corner case of someone using
+				// a 24-bit or 256-color color, fixible by using a flag
+				// indicating if we've set a ANSI color or not, but...
+				// meh.
+			}
+		case 2:
+			d.attr.Faint = true
+		case 22:
+			// normal intensity: neither bold nor faint
+			d.attr.Faint = false
+			d.attr.Bold = false
+			if d.Config.BoldColors {
+				// if BoldColors is enabled, unsetting bold drops
+				// the fg color
+				for i := range 8 {
+					if d.attr.Fg == ColorANSI(i+8) {
+						d.attr.Fg = ColorANSI(i)
+						break
+					}
+				}
+				// don't modify color if we're not using one of the
+				// vga colors. There is a corner case of someone using
+				// a 24-bit or 256-color color, fixible by using a flag
+				// indicating if we've set a ANSI color or not, but...
+				// meh.
+			}
+		case 3:
+			d.attr.Italic = true
+		case 23:
+			d.attr.Italic = false
+		case 4:
+			// 4:n picks the underline style
+			d.setUnderlineStyle(Param(params.Sub(i)).Get(1, 1))
+		case 21:
+			d.setUnderlineStyle(2)
+		case 24:
+			d.setUnderlineStyle(0)
+		case 5:
+			d.attr.Blink = true
+			if d.Config.ICEColors {
+				// with iCE colors, blink means a bright background
+				d.attr.Bg = d.iceBackground(d.attr.Bg, true)
+			}
+		case 6:
+			d.attr.RapidBlink = true
+		case 25:
+			d.attr.Blink = false
+			d.attr.RapidBlink = false
+			if d.Config.ICEColors {
+				d.attr.Bg = d.iceBackground(d.attr.Bg, false)
+			}
+		case 7:
+			d.attr.Reversed = true
+		case 27:
+			d.attr.Reversed = false
+		case 8:
+			d.attr.Conceal = true
+		case 28:
+			d.attr.Conceal = false
+		case 9:
+			d.attr.Strike = true
+		// case 10:
+		// 	d.Render.active.tileSet = d.Render.G0
+		// case 11:
+		// 	d.Render.active.tileSet = d.Render.G1
+		case 29:
+			d.attr.Strike = false
+		case 30, 31, 32, 33, 34, 35, 36, 37:
+			if d.Config.BoldColors && d.attr.Bold {
+				d.attr.Fg = ColorANSI(args[i] - 30 + 8)
+			} else {
+				d.attr.Fg = ColorANSI(args[i] - 30)
+			}
+		case 39:
+			d.attr.Fg = d.attrDefault.Fg
+		case 40, 41, 42, 43, 44, 45, 46, 47:
+			if d.Config.ICEColors && d.attr.Blink {
+				d.attr.Bg = ColorANSI(args[i] - 40 + 8)
+			} else {
+				d.attr.Bg = ColorANSI(args[i] - 40)
+			}
+		case 49:
+			d.attr.Bg = d.attrDefault.Bg
+			if d.Config.ICEColors && d.attr.Blink {
+				d.attr.Bg = d.iceBackground(d.attr.Bg, true)
+			}
+		case 90, 91, 92, 93, 94, 95, 96, 97:
+			d.attr.Fg = ColorANSI(args[i] - 90 + 8)
+		case 100, 101, 102, 103, 104, 105, 106, 107:
+			d.attr.Bg = ColorANSI(args[i] - 100 + 8)
+		// 24bit True Color and 256-Color support support
+		case 38, 48, 58:
+			which := args[i]
+			var c Color
+			var ok bool
+			if sub := params.Sub(i); len(sub) > 1 {
+				// colon form, 38:2::r:g:b; everything is in this parameter
+				c, _, ok = extendedColor(sub[1:], true)
+			} else {
+				// semicolon form, 38;2;r;g;b; eats the following parameters
+				var n int
+				c, n, ok = extendedColor(args[i+1:], false)
+				i += n
+			}
+			if !ok {
+				continue
+			}
+			switch which {
+			case 38:
+				d.attr.Fg = c
+			case 48:
+				d.attr.Bg = c
+			case 58:
+				d.attr.UnderlineColor = c
+				d.attr.UnderlineColored = true
+			}
+		case 59:
+			d.attr.UnderlineColored = false
+		case 51:
+			d.attr.Framed = true
+		case 52:
+			d.attr.Encircled = true
+		case 54:
+			d.attr.Framed = false
+			d.attr.Encircled = false
+		case 53:
+			d.attr.Overline = true
+		case 55:
+			d.attr.Overline = false
+		case 73:
+			d.attr.Superscript = true
+			d.attr.Subscript = false
+		case 74:
+			d.attr.Subscript = true
+			d.attr.Superscript = false
+		case 75:
+			d.attr.Superscript = false
+			d.attr.Subscript = false
+		default:
+			if ShowUnhandled {
+				log.Warn("unhandled SGR", "unhandled", args[i], "from", args)
+			}
+
+		} // switch for SGR
+
+	}
+}
+
+// extendedColor parses the color following SGR 38, 48 or 58: 5;n for the 256
+// color palette or 2;r;g;b for true color. In the colon form (ITU T.416) 2 is
+// followed by a colorspace ID before r, g and b, although plenty of programs
+// leave it out entirely; it is ignored either way. n is how many values were
+// used.
+func extendedColor(args []int, colon bool) (c Color, n int, ok bool) {
+	if len(args) == 0 {
+		return
+	}
+	switch args[0] {
+	case 5:
+		if len(args) < 2 {
+			return c, len(args), false
+		}
+		return Color256(max(args[1], 0)), 2, true
+	case 2:
+		rgb := args[1:]
+		if colon && len(rgb) > 3 {
+			rgb = rgb[1:]
+		}
+		rgb = slices.Clone(rgb[:min(len(rgb), 3)])
+		for i := range rgb {
+			// omitted values are 0
+			rgb[i] = max(rgb[i], 0)
+		}
+		r, g, b := getRGB(rgb)
+		return NewOpaqueColor(r, g, b), 4, true
+	}
+	return
+}
@@ -0,0 +1,120 @@
+package fansiterm
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestExtendedColor(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []int
+		colon  bool
+		want   Color
+		wantN  int
+		wantOK bool
+	}{
+		{"256", []int{5, 100}, false, Color256(100), 2, true},
+		{"256 omitted", []int{5, -1}, false, Color256(0), 2, true},
+		{"256 missing", []int{5}, false, Color{}, 1, false},
+		{"rgb", []int{2, 1, 2, 3}, false, NewOpaqueColor(1, 2, 3), 4, true},
+		{"rgb colon colorspace", []int{2, -1, 1, 2, 3}, true, NewOpaqueColor(1, 2, 3), 4, true},
+		{"rgb colon no colorspace", []int{2, 1, 2, 3}, true, NewOpaqueColor(1, 2, 3), 4, true},
+		{"rgb omitted", []int{2, -1, 5, -1}, false, NewOpaqueColor(0, 5, 0), 4, true},
+		{"unknown", []int{7}, false, Color{}, 0, false},
+		{"empty", nil, false, Color{}, 0, false},
+	}
+	for _, tt := range tests {
+		c, n, ok := extendedColor(tt.args, tt.colon)
+		if ok != tt.wantOK || n != tt.wantN || (ok && c != tt.want) {
+			t.Errorf("%s: got %v, %d, %v, want %v, %d, %v", tt.name, c, n, ok, tt.want, tt.wantN, tt.wantOK)
+		}
+	}
+}
+
+func TestSGRColors(t *testing.T) {
+	tests := []struct {
+		name string
+		seq  string
+		fg   Color
+		bg   Color
+		// underline is the underline style expected, or -1 for none
+		underline UnderlineStyle
+	}{
+		{"rgb colon", "38:2::1:2:3", NewOpaqueColor(1, 2, 3), defaultBg, -1},
+		{"rgb colon without colorspace", "38:2:1:2:3", NewOpaqueColor(1, 2, 3), defaultBg, -1},
+		{"rgb semicolon", "38;2;1;2;3", NewOpaqueColor(1, 2, 3), defaultBg, -1},
+		{"256 then more", "48;5;100;4:3", defaultFg, Color256(100), UnderlineCurly},
+		{"colon leaves the rest", "38:5:100;48;2;4;5;6", Color256(100), NewOpaqueColor(4, 5, 6), -1},
+		{"empty fields", "38:2::::", NewOpaqueColor(0, 0, 0), defaultBg, -1},
+		{"curly underline", "4:3", defaultFg, defaultBg, UnderlineCurly},
+		{"underline off", "4:3;4:0", defaultFg, defaultBg, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(10, 4, nil)
+			d.write([]byte("\x1b[" + tt.seq + "m"))
+			if d.attr.Fg != tt.fg || d.attr.Bg != tt.bg {
+				t.Errorf("fg %v, bg %v, want %v, %v", d.attr.Fg, d.attr.Bg, tt.fg, tt.bg)
+			}
+			switch {
+			case tt.underline < 0 && d.attr.Underline:
+				t.Errorf("underlined, want no underline")
+			case tt.underline >= 0 && (!d.attr.Underline || d.attr.UnderlineStyle != tt.underline):
+				t.Errorf("underline %v style %v, want style %v", d.attr.Underline, d.attr.UnderlineStyle, tt.underline)
+			}
+		})
+	}
+}
+
+func TestWindowReports(t *testing.T) {
+	tests := []struct {
+		seq, want string
+	}{
+		{"14", "\x1b[4;64;96t"},
+		{"14;0", "\x1b[4;64;96t"},
+		{"14;2", "\x1b[4;70;100t"},
+		{"16", "\x1b[6;16;8t"},
+		{"18", "\x1b[8;4;12t"},
+		{"19", "\x1b[9;4;12t"},
+	}
+	for _, tt := range tests {
+		// 12x4 cells, 96x64 pixels, fit the screen with some to spare
+		d := New(10, 4, image.NewRGBA(image.Rect(0, 0, 100, 70)))
+		var out bytes.Buffer
+		d.Output = &out
+		d.write([]byte("\x1b[" + tt.seq + "t"))
+		if got := out.String(); got != tt.want {
+			t.Errorf("CSI %s t: reply %q, want %q", tt.seq, got, tt.want)
+		}
+	}
+}
+
+func TestWindowResize(t *testing.T) {
+	tests := []struct {
+		seq        string
+		rows, cols int
+	}{
+		{"8;5;20", 5, 20},
+		{"8;0;20", 4, 20},
+		{"8;;20", 4, 20},
+		{"8;5", 5, 10},
+		{"8", 4, 10},
+		// pixels are rounded down to whole 8x16 cells
+		{"4;160;240", 10, 30},
+		{"4;100;100", 6, 12},
+		{"4;0;240", 4, 30},
+		{"4;160", 10, 10},
+		{"4", 4, 10},
+	}
+	for _, tt := range tests {
+		d := New(10, 4, nil)
+		rows, cols := -1, -1
+		d.ResizeRequestFunc = func(r, c int) { rows, cols = r, c }
+		d.write([]byte("\x1b[" + tt.seq + "t"))
+		if rows != tt.rows || cols != tt.cols {
+			t.Errorf("CSI %s t: asked for %dx%d, want %dx%d", tt.seq, rows, cols, tt.rows, tt.cols)
+		}
+	}
+}
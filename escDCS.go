@@ -0,0 +1,23 @@
+package fansiterm
+
+// handleDCSSequence handles Device Control Strings, ESC P params inter final
+// data ST. inter has any private marker first, then the intermediates.
+func (d *Device) handleDCSSequence(final byte, params []Param, inter string, data []rune) {
+	if d.customDCS(final, params, inter, data) {
+		return
+	}
+	args := make([]int, len(params))
+	for i, p := range params {
+		args[i] = p.Get(0, 0)
+	}
+	switch {
+	case final == 'q' && inter == "": // sixel graphics
+		d.handleSixel(args, data)
+	case final == 'p' && inter == "": // ReGIS graphics
+		d.handleReGIS(args, data)
+	default:
+		if ShowUnhandled {
+			log.Warn("unhandled DCS", "final", string(final), "intermediates", inter, "params", args)
+		}
+	}
+}
@@ -24,7 +24,9 @@ func colorToHex(c color.Color) string {
 }
 
 func (d *Device) handleFansiSequence(seq []rune) {
-	seq = trimST(seq)
+	if len(seq) > 0 && d.customFansi(seq) {
+		return
+	}
 	if len(seq) <= 1 {
 		// Doing nothing seems safe...
 		return
@@ -32,7 +34,7 @@ func (d *Device) handleFansiSequence(seq []rune) {
 	params := splitParams(seq[1:])
 	switch seq[0] {
 	case 'A', 'a': // A for At(); report color at pixel specified by absolute addressing (A) or relative to cursor (a)
-		fmt.Fprintf(d.Output, "OKAY")
+		fmt.Fprintf(d.output(), "OKAY")
 		var loc image.Point
 		fmt.Sscanf(string(params[0]), "%d,%d", &loc.X, &loc.Y)
 		loc = loc.Add(d.Render.bounds.Min)
@@ -40,7 +42,7 @@ func (d *Device) handleFansiSequence(seq []rune) {
 			loc = loc.Add(d.cursorPt())
 		}
 		c := d.Render.At(loc.X, loc.Y)
-		fmt.Fprintf(d.Output, "\x1b/%c%d,%d;%s\a", seq[0], loc.X, loc.Y, colorToHex(c))
+		fmt.Fprintf(d.output(), "\x1b/%c%d,%d;%s\a", seq[0], loc.X, loc.Y, colorToHex(c))
 	case 'B': // B for Blit
 		// ESC/B<pixdata>ESC\
 		// Display image defined by pixdata at cursor location; no scalling is done
@@ -151,7 +153,7 @@ func (d *Device) handleFansiSequence(seq []rune) {
 
 		//increment cursor as though we just rendered a regular tile
 		d.cursor.col++
-		if d.Config.Wraparound {
+		if !d.Config.Wraparound {
 			d.cursor.col = bound(d.cursor.col, 0, d.cols-1)
 		}
 
@@ -196,7 +198,6 @@ func (d *Device) handleFansiSequence(seq []rune) {
 			pt1, pt2 image.Point
 			c        color.Color
 			r, g, b  int
-			swap     bool
 		)
 		n, _ := fmt.Sscanf(string(seq), "L%d,%d;%d,%d;#%2x%2x%2x", &pt1.X, &pt1.Y, &pt2.X, &pt2.Y, &r, &g, &b)
 		if n == 4 {
@@ -208,53 +209,7 @@ func (d *Device) handleFansiSequence(seq []rune) {
 			c = NewOpaqueColor(uint8(r), uint8(g), uint8(b))
 		}
 
-		pt1, pt2 = pt1.Add(d.Render.bounds.Min), pt2.Add(d.Render.bounds.Min)
-
-		dx := pt1.X - pt2.X
-		dy := pt1.Y - pt2.Y
-
-		var x_step, y_step int
-
-		if dx < 0 {
-			dx *= -1
-		}
-		if dy < 0 {
-			dy *= -1
-		}
-
-		if dy > dx {
-			dx, dy = dy, dx
-			pt1.X, pt1.Y = pt1.Y, pt1.X
-			pt2.X, pt2.Y = pt2.Y, pt2.X
-			swap = true
-		}
-
-		if pt1.X < pt2.X {
-			x_step = 1
-		} else {
-			x_step = -1
-		}
-		if pt1.Y < pt2.Y {
-			y_step = 1
-		} else {
-			y_step = -1
-		}
-		p := 2*dy - dx
-
-		x, y := pt1.X, pt1.Y
-		for range dx {
-			if swap {
-				d.Render.Set(y, x, c)
-			} else {
-				d.Render.Set(x, y, c)
-			}
-			if p >= 0 {
-				y += y_step
-				p -= 2 * dx
-			}
-			x += x_step
-			p += 2 * dy
-		}
+		drawLine(d.Render, pt1.Add(d.Render.bounds.Min), pt2.Add(d.Render.bounds.Min), c)
 	case 'P': // P for Palette
 		var (
 			t  byte
@@ -282,7 +237,6 @@ func (d *Device) handleFansiSequence(seq []rune) {
 	case 'R': // R for radius (to make circles)
 		var (
 			x, y, r int
-			rect    image.Rectangle
 			c       color.RGBA
 			nc      Color
 			n       int
@@ -303,20 +257,7 @@ func (d *Device) handleFansiSequence(seq []rune) {
 			return
 		}
 
-		rect.Min.X = x - r
-		rect.Max.X = x + r
-		rect.Min.Y = y - r
-		rect.Max.Y = y + r
-
-		rect = rect.Canon()
-		for yp := rect.Min.Y; yp <= rect.Max.Y; yp++ {
-			for xp := rect.Min.X; xp <= rect.Max.X; xp++ {
-				pt := image.Pt(xp, yp).Add(d.Render.bounds.Min)
-				if r*r >= (xp-x)*(xp-x)+(yp-y)*(yp-y) {
-					d.Render.Set(pt.X, pt.Y, nc)
-				}
-			}
-		}
+		fillCircle(d.Render, image.Pt(x, y).Add(d.Render.bounds.Min), r, nc)
 	case 'b': // b for box to draw non-filled rectangles
 		var (
 			rect image.Rectangle
@@ -339,16 +280,7 @@ func (d *Device) handleFansiSequence(seq []rune) {
 			return
 		}
 
-		rect = rect.Canon().Add(d.Render.bounds.Min)
-
-		for x := rect.Min.X; x <= rect.Max.X; x++ {
-			d.Render.Set(x, rect.Min.Y, nc)
-			d.Render.Set(x, rect.Max.Y, nc)
-		}
-		for y := rect.Min.Y; y <= rect.Max.Y; y++ {
-			d.Render.Set(rect.Min.X, y, nc)
-			d.Render.Set(rect.Max.X, y, nc)
-		}
+		drawBox(d.Render, rect.Canon().Add(d.Render.bounds.Min), nc)
 	case 'r': // r for radius to make non-filled circles
 		var (
 			x, y, r int
@@ -372,29 +304,7 @@ func (d *Device) handleFansiSequence(seq []rune) {
 			return
 		}
 
-		x += d.Render.bounds.Min.X
-		y += d.Render.bounds.Min.Y
-
-		xp := 0
-		yp := r
-		de := 3 - 2*r
-		for xp <= yp {
-			d.Render.Set(xp+x, yp+y, nc)
-			d.Render.Set(xp+x, -yp+y, nc)
-			d.Render.Set(-xp+x, yp+y, nc)
-			d.Render.Set(-xp+x, -yp+y, nc)
-			d.Render.Set(yp+x, xp+y, nc)
-			d.Render.Set(yp+x, -xp+y, nc)
-			d.Render.Set(-yp+x, xp+y, nc)
-			d.Render.Set(-yp+x, -xp+y, nc)
-			if de < 0 {
-				de = de + 4*xp + 6
-			} else {
-				de = de + 4*(xp-yp) + 10
-				yp--
-			}
-			xp++
-		}
+		drawCircle(d.Render, image.Pt(x, y).Add(d.Render.bounds.Min), r, nc)
 
 		// draw a circle using polar coordinates. Only calculate 1/8 the circle and use
 		// symmetry to plot the rest.
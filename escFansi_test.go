@@ -0,0 +1,57 @@
+package fansiterm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"testing"
+)
+
+// noisePNG is a w by h PNG of random pixels, which doesn't compress.
+func noisePNG(t *testing.T, w, h int) (*image.RGBA, []byte) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	rng := rand.New(rand.NewSource(1))
+	for i := range img.Pix {
+		img.Pix[i] = byte(rng.Intn(256))
+		if i%4 == 3 {
+			img.Pix[i] = 0xff
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return img, buf.Bytes()
+}
+
+// TestImagesDefaultConfig checks that images of a usual size fit within the
+// default MaxSequenceLength.
+func TestImagesDefaultConfig(t *testing.T) {
+	img, data := noisePNG(t, 120, 80)
+	b64 := base64.StdEncoding.EncodeToString(data)
+	if len(b64) < 32<<10 {
+		t.Fatalf("test image is only %d bytes", len(b64))
+	}
+
+	for _, tt := range []struct {
+		name string
+		seq  string
+	}{
+		{"blit", "\x1b/B0,0;" + b64 + "\x1b\\"},
+		{"iterm2", "\x1b]1337;File=inline=1;width=120px;height=80px;preserveAspectRatio=0:" + b64 + "\a"},
+	} {
+		d := New(40, 10, nil)
+		d.write([]byte(tt.seq))
+		for _, pt := range []image.Point{{0, 0}, {60, 40}, {119, 79}} {
+			want := img.RGBAAt(pt.X, pt.Y)
+			got := color.RGBAModel.Convert(d.Render.At(d.Render.bounds.Min.X+pt.X, d.Render.bounds.Min.Y+pt.Y))
+			if got != want {
+				t.Errorf("%s: pixel %v is %v, want %v", tt.name, pt, got, want)
+			}
+		}
+	}
+}
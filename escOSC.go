@@ -3,30 +3,57 @@ package fansiterm
 import (
 	"fmt"
 	"image/color"
+	"strconv"
 )
 
 func (d *Device) handleOSCSequence(seq []rune) {
-	seq = trimST(seq)
 	if len(seq) == 0 {
 		// what does an empty OSC sequence mean?
 		// Doing nothing seems safe...
 		return
 	}
-	args := getNumericArgs(seq, 0)
-	switch args[0] {
-	case 0:
-		// xterm set window title
-		d.Config.Properties[PropertyWindowTitle] = string(seq[2:])
-		d.configChange()
+	code, text := splitOSC(seq)
+	if d.customOSC(code, text) {
+		return
+	}
+	switch code {
+	case 0: // set icon name and window title
+		d.setProperty(PropertyIconName, text)
+		d.setProperty(PropertyWindowTitle, text)
+	case 1: // set icon name
+		d.setProperty(PropertyIconName, text)
+	case 2: // set window title
+		d.setProperty(PropertyWindowTitle, text)
+	case 7: // current working directory, as a file:// URL
+		d.setProperty(PropertyWorkingDirectory, text)
 	case 10: // query default foreground color
 		fg := color.RGBAModel.Convert(d.attrDefault.Fg).(color.RGBA)
-		fmt.Fprintf(d.Output, "\x1b]10;rgb:%d/%d/%d\x1b/", fg.R, fg.G, fg.B)
+		fmt.Fprintf(d.output(), "\x1b]10;rgb:%d/%d/%d\x1b/", fg.R, fg.G, fg.B)
 	case 11: // query default background color
 		bg := color.RGBAModel.Convert(d.attrDefault.Bg).(color.RGBA)
-		fmt.Fprintf(d.Output, "\x1b]11;rgb:%d/%d/%d\x1b/", bg.R, bg.G, bg.B)
+		fmt.Fprintf(d.output(), "\x1b]11;rgb:%d/%d/%d\x1b/", bg.R, bg.G, bg.B)
+	case 1337: // iTerm2 proprietary sequences, e.g. inline images
+		d.handleITerm2(text)
 	default:
 		if ShowUnhandled {
 			log.Warn("unhandled OSC", "sequence", seqString(seq))
 		}
 	}
 }
+
+// splitOSC breaks an OSC body into its numeric code and the text following
+// the first ';'. If the code isn't a number, code is -1.
+func splitOSC(seq []rune) (code int, text string) {
+	i := 0
+	for i < len(seq) && seq[i] != ';' {
+		i++
+	}
+	code, err := strconv.Atoi(string(seq[:i]))
+	if err != nil {
+		code = -1
+	}
+	if i < len(seq) {
+		text = string(seq[i+1:])
+	}
+	return
+}
@@ -4,11 +4,8 @@ go 1.23
 
 require (
 	github.com/mattn/go-runewidth v0.0.16
+	github.com/rivo/uniseg v0.2.0
 	github.com/sparques/gfx v0.0.1
 	golang.org/x/exp v0.0.0-20240409090435-93d18d7e34b8
-)
-
-require (
-	github.com/rivo/uniseg v0.2.0 // indirect
-	golang.org/x/image v0.23.0 // indirect
+	golang.org/x/image v0.23.0
 )
@@ -0,0 +1,124 @@
+package fansiterm
+
+import (
+	"image"
+	"slices"
+
+	"github.com/rivo/uniseg"
+)
+
+// grapheme.go splits text into grapheme clusters (UAX #29) so that a base
+// character and everything that modifies it (combining marks, variation
+// selectors, ZWJ sequences, regional indicator pairs) is measured and drawn
+// as one unit.
+
+const (
+	zeroWidthJoiner = 0x200D
+	textSelector    = 0xFE0E // VS15
+	emojiSelector   = 0xFE0F // VS16
+)
+
+// lastCluster remembers the most recently drawn cluster, so that a combining
+// mark arriving in a later Write can still be added to it.
+type lastCluster struct {
+	runes []rune
+	// pos is where the cluster was drawn and end is where the cursor was
+	// left afterwards.
+	pos, end image.Point
+}
+
+func isVariationSelector(r rune) bool {
+	return (r >= 0xFE00 && r <= 0xFE0F) || (r >= 0xE0100 && r <= 0xE01EF)
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// runeWidth is the number of cells a single rune takes up.
+func runeWidth(r rune) int {
+	if r <= 255 {
+		return 1
+	}
+	return unicode.RuneWidth(r)
+}
+
+// clusterWidth is the number of cells a grapheme cluster takes up. That's
+// the width of its first rune, unless a variation selector or a second
+// regional indicator says otherwise. A lone combining mark gets a cell of its
+// own.
+func clusterWidth(cluster []rune) int {
+	width := runeWidth(cluster[0])
+	for _, r := range cluster[1:] {
+		switch {
+		case r == emojiSelector:
+			width = 2
+		case r == textSelector:
+			width = 1
+		case isRegionalIndicator(r) && isRegionalIndicator(cluster[0]):
+			width = 2
+		}
+	}
+	return max(width, 1)
+}
+
+// writeText draws a run of printable runes, a grapheme cluster at a time,
+// advancing the cursor and wrapping as it goes.
+func (d *Device) writeText(text []rune) {
+	cursor := image.Pt(d.cursor.col, d.cursor.row)
+	prev := d.cluster
+	continued := len(prev.runes) > 0 && prev.end == cursor
+	if continued {
+		text = append(slices.Clone(prev.runes), text...)
+	}
+
+	g := uniseg.NewGraphemes(string(text))
+	for g.Next() {
+		cluster := g.Runes()
+		if continued {
+			continued = false
+			if len(cluster) == len(prev.runes) {
+				// nothing was added to it
+				continue
+			}
+			// redraw the whole cluster where it was
+			d.cursor.col, d.cursor.row = prev.pos.X, prev.pos.Y
+		}
+
+		// The cursor is left one past the last column after writing there
+		// (the DEC "pending wrap" state), so it's only here that we find out
+		// whether to wrap. A wide cluster that doesn't fit in what's left of
+		// the line wraps as a whole, leaving a blank cell behind.
+		width := clusterWidth(cluster)
+		if d.cursor.col+width > d.cols {
+			if d.Config.Wraparound {
+				d.Clear(d.cursor.col, d.cursor.row, d.cols, d.cursor.row+1)
+				d.cursor.col = 0
+				// scroll if necessary otherwise just move on to the next row
+				if d.cursor.row == d.scrollRegion[1] {
+					d.Scroll(1)
+				} else if d.cursor.row < d.rows-1 {
+					d.cursor.row++
+				}
+			} else {
+				// no autowrap: keep overwriting the last column; anything
+				// too wide is clipped at the margin
+				d.cursor.col = max(d.cols-1, 0)
+			}
+		}
+		pos := image.Pt(d.cursor.col, d.cursor.row)
+
+		// Render cluster and then
+		// increment cursor by its width
+		d.cursor.col += d.RenderCluster(cluster)
+		if !d.Config.Wraparound {
+			d.cursor.col = min(d.cursor.col, d.cols-1)
+		}
+
+		d.cluster = lastCluster{
+			runes: cluster,
+			pos:   pos,
+			end:   image.Pt(d.cursor.col, d.cursor.row),
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package fansiterm
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+// cellInked is whether anything other than the default background is drawn
+// in a cell.
+func cellInked(d *Device, col, row int) bool {
+	cell := d.Render.cell.Add(image.Pt(col*d.Render.cell.Dx(), row*d.Render.cell.Dy())).Add(d.Render.bounds.Min)
+	for y := cell.Min.Y; y < cell.Max.Y; y++ {
+		for x := cell.Min.X; x < cell.Max.X; x++ {
+			if !sameColor(d.Render.At(x, y), defaultBg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestWriteTextWrap(t *testing.T) {
+	// VS16 makes a wide smiley whose background covers both cells
+	const wide = "\u263a\ufe0f"
+	tests := []struct {
+		name   string
+		seq    string
+		cursor image.Point
+		inked  []image.Point
+		blank  []image.Point
+	}{
+		{"fits", "\x1b[1;9H" + wide, image.Pt(10, 0),
+			[]image.Point{{8, 0}, {9, 0}}, []image.Point{{0, 1}}},
+		{"wide wraps", "\x1b[1;10H" + wide, image.Pt(2, 1),
+			[]image.Point{{0, 1}, {1, 1}}, []image.Point{{9, 0}}},
+		{"wide wraps and scrolls", "\x1b[4;10H" + wide, image.Pt(2, 3),
+			[]image.Point{{0, 3}, {1, 3}}, []image.Point{{9, 2}}},
+		{"cjk wraps", "\x1b[1;10H中", image.Pt(2, 1),
+			[]image.Point{{0, 1}}, []image.Point{{9, 0}}},
+		{"narrow wraps", "\x1b[1;10Hab", image.Pt(1, 1),
+			[]image.Point{{9, 0}, {0, 1}}, nil},
+		{"no autowrap", "\x1b[?7l\x1b[1;9Habcd", image.Pt(9, 0),
+			[]image.Point{{8, 0}, {9, 0}}, []image.Point{{0, 1}}},
+		{"no autowrap wide clipped", "\x1b[?7l\x1b[1;10H" + wide, image.Pt(9, 0),
+			[]image.Point{{9, 0}}, []image.Point{{0, 1}}},
+		{"autowrap back on", "\x1b[?7l\x1b[?7h\x1b[1;10Hab", image.Pt(1, 1),
+			[]image.Point{{9, 0}, {0, 1}}, nil},
+	}
+	for _, tt := range tests {
+		d := New(10, 4, nil)
+		// hide the cursor, and draw in reverse so even a cell without a
+		// glyph is inked
+		d.write([]byte("\x1b[?25l\x1b[7m" + tt.seq))
+		if got := image.Pt(d.cursor.col, d.cursor.row); got != tt.cursor {
+			t.Errorf("%s: cursor at %v, want %v", tt.name, got, tt.cursor)
+		}
+		for _, c := range tt.inked {
+			if !cellInked(d, c.X, c.Y) {
+				t.Errorf("%s: cell %v blank", tt.name, c)
+			}
+		}
+		for _, c := range tt.blank {
+			if cellInked(d, c.X, c.Y) {
+				t.Errorf("%s: cell %v drawn on", tt.name, c)
+			}
+		}
+	}
+}
+
+func TestPendingWrap(t *testing.T) {
+	// after writing in the last column, the wrap waits for the next character
+	const last = "\x1b[?25l\x1b[7m\x1b[1;10Ha\x1b[m"
+	tests := []struct {
+		name   string
+		seq    string
+		cursor image.Point
+	}{
+		{"pending", last, image.Pt(10, 0)},
+		{"then printed", last + "b", image.Pt(1, 1)},
+		{"cup", last + "\x1b[2;1Hb", image.Pt(1, 1)},
+		{"cup same row", last + "\x1b[1;1Hb", image.Pt(1, 0)},
+		{"cursor left", last + "\x1b[Db", image.Pt(9, 0)},
+		{"backspace", last + "\bb", image.Pt(9, 0)},
+		{"carriage return", last + "\rb", image.Pt(1, 0)},
+	}
+	for _, tt := range tests {
+		d := New(10, 4, nil)
+		d.write([]byte(tt.seq))
+		if got := image.Pt(d.cursor.col, d.cursor.row); got != tt.cursor {
+			t.Errorf("%s: cursor at %v, want %v", tt.name, got, tt.cursor)
+		}
+	}
+
+	// the cursor is reported in the last column
+	d := New(10, 4, nil)
+	var out bytes.Buffer
+	d.Output = &out
+	d.write([]byte(last + "\x1b[6n"))
+	if got := out.String(); got != "\x1b[1;10R" {
+		t.Errorf("DSR 6: reply %q, want %q", got, "\x1b[1;10R")
+	}
+
+	// and erasing to the end of the line erases the last column
+	for _, el := range []string{"\x1b[K", "\x1b[0K", "\x1b[J"} {
+		d := New(10, 4, nil)
+		d.write([]byte(last + el))
+		if cellInked(d, 9, 0) {
+			t.Errorf("%q: last column not erased", el)
+		}
+	}
+}
+
+func TestClusterWidth(t *testing.T) {
+	tests := []struct {
+		name    string
+		cluster string
+		want    int
+	}{
+		{"ascii", "a", 1},
+		{"combining", "e\u0301", 1},
+		{"lone combining", "\u0301", 1},
+		{"wide", "中", 2},
+		{"emoji", "\U0001f600", 2},
+		{"emoji text", "\U0001f600\ufe0e", 1},
+		{"symbol", "\u263a", 1},
+		{"symbol emoji", "\u263a\ufe0f", 2},
+		{"zwj", "\U0001f469\u200d\U0001f4bb", 2},
+		{"flag", "\U0001f1fa\U0001f1f8", 2},
+	}
+	for _, tt := range tests {
+		if got := clusterWidth([]rune(tt.cluster)); got != tt.want {
+			t.Errorf("%s: width %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteTextClusters(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		col    int
+	}{
+		{"combining", []string{"e\u0301x"}, 2},
+		{"combining later", []string{"e", "\u0301", "x"}, 2},
+		{"two combining later", []string{"e", "\u0301", "\u0323"}, 1},
+		{"combining after a control", []string{"e", "\x1b[C", "\u0301"}, 3},
+		{"vs16", []string{"\u263a\ufe0fx"}, 3},
+		{"vs16 later", []string{"\u263a", "\ufe0f", "x"}, 3},
+		{"vs15", []string{"\U0001f600\ufe0ex"}, 2},
+		{"vs15 later", []string{"\U0001f600", "\ufe0e", "x"}, 2},
+		{"zwj", []string{"\U0001f469\u200d\U0001f4bbx"}, 3},
+		{"zwj split", []string{"\U0001f469\u200d", "\U0001f4bb", "x"}, 3},
+		{"flags", []string{"\U0001f1fa\U0001f1f8\U0001f1ec\U0001f1e7x"}, 5},
+		{"flag split", []string{"\U0001f1fa", "\U0001f1f8", "x"}, 3},
+		{"three indicators", []string{"\U0001f1fa\U0001f1f8\U0001f1ec"}, 3},
+	}
+	for _, tt := range tests {
+		d := New(20, 4, nil)
+		for _, w := range tt.writes {
+			d.write([]byte(w))
+		}
+		if d.cursor.col != tt.col {
+			t.Errorf("%s: column %d, want %d", tt.name, d.cursor.col, tt.col)
+		}
+	}
+}
+
+func TestCombiningLater(t *testing.T) {
+	// a mark in its own write is drawn the same as one written with its
+	// base; the font has a tile for U+0300, the combining grave accent
+	whole := New(10, 4, nil)
+	whole.write([]byte("\x1b[?25le\u0300"))
+	split := New(10, 4, nil)
+	split.write([]byte("\x1b[?25le"))
+	split.write([]byte("\u0300"))
+	plain := New(10, 4, nil)
+	plain.write([]byte("\x1b[?25le"))
+
+	cell := whole.Render.cell.Add(whole.Render.bounds.Min)
+	same, marked := true, false
+	for y := cell.Min.Y; y < cell.Max.Y; y++ {
+		for x := cell.Min.X; x < cell.Max.X; x++ {
+			same = same && sameColor(whole.Render.At(x, y), split.Render.At(x, y))
+			marked = marked || !sameColor(whole.Render.At(x, y), plain.Render.At(x, y))
+		}
+	}
+	if !same {
+		t.Errorf("mark written later drawn differently")
+	}
+	if !marked {
+		t.Errorf("mark not drawn")
+	}
+}
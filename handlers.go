@@ -0,0 +1,141 @@
+package fansiterm
+
+import (
+	"io"
+
+	"github.com/sparques/fansiterm/parser"
+)
+
+// handlers.go lets programs add escape sequences of their own, or replace
+// the built-in ones, without touching the parser. Handlers are looked up
+// before the built-in handling of a sequence; if one returns false, the
+// sequence is handled as though it weren't registered.
+//
+// Handlers are called from Write with the Device locked, so they must not
+// call methods that lock it. Anything written to reply is sent to Output,
+// using 8-bit controls after S8C1T.
+
+// CSIHandler handles a control sequence, given its parameters.
+type CSIHandler func(params []Param, reply io.Writer) bool
+
+// OSCHandler handles an operating system command, given the text after the
+// code and its ';'.
+type OSCHandler func(text string, reply io.Writer) bool
+
+// DCSHandler handles a device control string, given its parameters and the
+// data after the final character.
+type DCSHandler func(params []Param, data string, reply io.Writer) bool
+
+// FansiHandler handles a fansiterm private sequence (ESC / verb args ST),
+// given everything after the verb.
+type FansiHandler func(args string, reply io.Writer) bool
+
+type handlerRegistry struct {
+	csi   map[seqKey]CSIHandler
+	osc   map[int]OSCHandler
+	dcs   map[seqKey]DCSHandler
+	fansi map[rune]FansiHandler
+}
+
+// seqKey identifies a CSI or DCS sequence by its final character and its
+// private markers and intermediates, in the order they appear, e.g. "?" for
+// CSI ? 25 h and " " for CSI 2 SP q.
+type seqKey struct {
+	final         rune
+	intermediates string
+}
+
+// HandleCSI registers fn to handle control sequences ending in final with
+// the given private markers and intermediates. A nil fn removes the handler.
+//
+//	d.HandleCSI('b', "?", func(params []Param, reply io.Writer) bool {
+//		setBacklight(params[0].Get(0, 100))
+//		return true
+//	})
+func (d *Device) HandleCSI(final rune, intermediates string, fn CSIHandler) {
+	d.Lock()
+	defer d.Unlock()
+	key := seqKey{final, intermediates}
+	if fn == nil {
+		delete(d.handlers.csi, key)
+		return
+	}
+	if d.handlers.csi == nil {
+		d.handlers.csi = make(map[seqKey]CSIHandler)
+	}
+	d.handlers.csi[key] = fn
+}
+
+// HandleOSC registers fn to handle OSC code. A nil fn removes the handler.
+func (d *Device) HandleOSC(code int, fn OSCHandler) {
+	d.Lock()
+	defer d.Unlock()
+	if fn == nil {
+		delete(d.handlers.osc, code)
+		return
+	}
+	if d.handlers.osc == nil {
+		d.handlers.osc = make(map[int]OSCHandler)
+	}
+	d.handlers.osc[code] = fn
+}
+
+// HandleDCS registers fn to handle device control strings introduced by
+// final, with the given private markers and intermediates. A nil fn removes
+// the handler.
+func (d *Device) HandleDCS(final rune, intermediates string, fn DCSHandler) {
+	d.Lock()
+	defer d.Unlock()
+	key := seqKey{final, intermediates}
+	if fn == nil {
+		delete(d.handlers.dcs, key)
+		return
+	}
+	if d.handlers.dcs == nil {
+		d.handlers.dcs = make(map[seqKey]DCSHandler)
+	}
+	d.handlers.dcs[key] = fn
+}
+
+// HandleFansi registers fn to handle the fansiterm private sequence verb.
+// A nil fn removes the handler.
+func (d *Device) HandleFansi(verb rune, fn FansiHandler) {
+	d.Lock()
+	defer d.Unlock()
+	if fn == nil {
+		delete(d.handlers.fansi, verb)
+		return
+	}
+	if d.handlers.fansi == nil {
+		d.handlers.fansi = make(map[rune]FansiHandler)
+	}
+	d.handlers.fansi[verb] = fn
+}
+
+// customCSI runs the handler registered for a control sequence, if there is
+// one, and reports whether it handled it.
+func (d *Device) customCSI(final byte, params *parser.Params, inter []byte) bool {
+	fn, ok := d.handlers.csi[seqKey{rune(final), string(inter)}]
+	return ok && fn(getParams(params), d.output())
+}
+
+// customOSC runs the handler registered for an OSC code, if there is one,
+// and reports whether it handled it.
+func (d *Device) customOSC(code int, text string) bool {
+	fn, ok := d.handlers.osc[code]
+	return ok && fn(text, d.output())
+}
+
+// customDCS runs the handler registered for a device control string, if
+// there is one, and reports whether it handled it.
+func (d *Device) customDCS(final byte, params []Param, inter string, data []rune) bool {
+	fn, ok := d.handlers.dcs[seqKey{rune(final), inter}]
+	return ok && fn(params, string(data), d.output())
+}
+
+// customFansi runs the handler registered for a fansiterm private sequence,
+// if there is one, and reports whether it handled it.
+func (d *Device) customFansi(seq []rune) bool {
+	fn, ok := d.handlers.fansi[seq[0]]
+	return ok && fn(string(seq[1:]), d.output())
+}
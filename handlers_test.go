@@ -0,0 +1,136 @@
+package fansiterm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestHandleCSI(t *testing.T) {
+	d := New(10, 4, nil)
+	handled := true
+	calls := 0
+	d.HandleCSI('l', "?", func(params []Param, reply io.Writer) bool {
+		calls++
+		return handled || params[0].Get(0, 0) != 25
+	})
+
+	// overrides the built-in cursor hiding
+	d.write([]byte("\x1b[?25l"))
+	if !d.cursor.show || calls != 1 {
+		t.Errorf("overridden: cursor shown %v, handler called %d times", d.cursor.show, calls)
+	}
+
+	// CSI 25 l, with no private marker, is not the registered sequence
+	d.write([]byte("\x1b[25l"))
+	if calls != 1 {
+		t.Errorf("handler called for a sequence without the marker")
+	}
+
+	// returning false leaves it to the built-in handling
+	handled = false
+	d.write([]byte("\x1b[?25l"))
+	if d.cursor.show || calls != 2 {
+		t.Errorf("declined: cursor shown %v, handler called %d times", d.cursor.show, calls)
+	}
+
+	// removed, the built-in handling is back
+	d.HandleCSI('l', "?", nil)
+	d.write([]byte("\x1b[?25h\x1b[?25l"))
+	if d.cursor.show || calls != 2 {
+		t.Errorf("removed: cursor shown %v, handler called %d times", d.cursor.show, calls)
+	}
+}
+
+func TestHandleCSIIntermediates(t *testing.T) {
+	d := New(10, 4, nil)
+	var got []Param
+	d.HandleCSI('q', " ", func(params []Param, reply io.Writer) bool {
+		got = params
+		return true
+	})
+	d.write([]byte("\x1b[4 q"))
+	if len(got) != 1 || got[0].Get(0, 0) != 4 {
+		t.Errorf("CSI 4 SP q: handler got %v", got)
+	}
+}
+
+func TestHandlerReply(t *testing.T) {
+	d := New(10, 4, nil)
+	var out bytes.Buffer
+	d.Output = &out
+	d.HandleCSI('n', "", func(params []Param, reply io.Writer) bool {
+		if params[0].Get(0, 0) != 99 {
+			return false
+		}
+		fmt.Fprint(reply, "\x1b[?99;1n")
+		return true
+	})
+
+	d.write([]byte("\x1b[99n"))
+	if got := out.String(); got != "\x1b[?99;1n" {
+		t.Errorf("reply %q, want %q", got, "\x1b[?99;1n")
+	}
+
+	// after S8C1T, the reply uses 8-bit controls
+	out.Reset()
+	d.write([]byte("\x1b G\x1b[99n"))
+	if got := out.String(); got != "\x9b?99;1n" {
+		t.Errorf("8-bit reply %q, want %q", got, "\x9b?99;1n")
+	}
+
+	// a declined sequence still gets the built-in reply
+	out.Reset()
+	d.write([]byte("\x1b[5n"))
+	if got := out.String(); got != "\x9b0n" {
+		t.Errorf("built-in reply %q, want %q", got, "\x9b0n")
+	}
+}
+
+func TestHandleOSC(t *testing.T) {
+	d := New(10, 4, nil)
+	var got string
+	d.HandleOSC(2, func(text string, reply io.Writer) bool {
+		got = text
+		return true
+	})
+	title := d.Config.Properties[PropertyWindowTitle]
+	d.write([]byte("\x1b]2;hello\a"))
+	if got != "hello" || d.Config.Properties[PropertyWindowTitle] != title {
+		t.Errorf("overridden: handler got %q, title %q", got, d.Config.Properties[PropertyWindowTitle])
+	}
+
+	d.HandleOSC(2, nil)
+	d.write([]byte("\x1b]2;world\a"))
+	if d.Config.Properties[PropertyWindowTitle] != "world" {
+		t.Errorf("removed: title %q, want %q", d.Config.Properties[PropertyWindowTitle], "world")
+	}
+}
+
+func TestHandleDCS(t *testing.T) {
+	d := New(10, 4, nil)
+	var params []Param
+	var data string
+	d.HandleDCS('z', "$", func(p []Param, s string, reply io.Writer) bool {
+		params, data = p, s
+		return true
+	})
+	d.write([]byte("\x1bP1;2$zabc\x1b\\"))
+	if len(params) != 2 || params[1].Get(0, 0) != 2 || data != "abc" {
+		t.Errorf("handler got %v, %q", params, data)
+	}
+}
+
+func TestHandleFansi(t *testing.T) {
+	d := New(10, 4, nil)
+	var got string
+	d.HandleFansi('Z', func(args string, reply io.Writer) bool {
+		got = args
+		return true
+	})
+	d.write([]byte("\x1b/Zsome args\x1b\\"))
+	if got != "some args" {
+		t.Errorf("handler got %q, want %q", got, "some args")
+	}
+}
@@ -0,0 +1,330 @@
+package fansiterm
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/sparques/fansiterm/parser"
+)
+
+// input.go runs what's written to the Device through the parser package and
+// turns what it finds back into calls to the handlers in ansi.go, escCSI.go
+// and friends. A few things the parser doesn't know about are picked out
+// before it sees them: Tek mode, VT52 escape sequences, the fansiterm private
+// sequences (ESC / verb args ST) and the linux palette reset, ESC ] R.
+
+// inputState is what's remembered about the input between writes.
+type inputState struct {
+	parser parser.Parser
+
+	// text collects printable runes, so a whole run can be handed to
+	// writeText and split into grapheme clusters.
+	text []rune
+
+	// dcs collects the data of a device control string, introduced by
+	// dcsFinal, dcsParams and dcsInter. dcsDrop is set when it gets too long.
+	dcs       []byte
+	dcsFinal  byte
+	dcsParams []Param
+	dcsInter  string
+	dcsDrop   bool
+
+	// fansi collects a fansiterm private sequence while inFansi is set.
+	// fansiESC is set when its last rune was ESC, which may be the start of
+	// ST, and fansiDrop when it gets too long.
+	fansi                        []rune
+	inFansi, fansiESC, fansiDrop bool
+
+	// vt52 collects a VT52 escape sequence.
+	vt52 []rune
+
+	// prev are the last two runes given to the parser.
+	prev [2]rune
+
+	// last is when the last write happened, for Config.SequenceTimeout.
+	last time.Time
+}
+
+// reset drops anything unfinished.
+func (in *inputState) reset() {
+	in.parser.Reset()
+	in.text = in.text[:0]
+	in.dcs, in.dcsDrop = in.dcs[:0], false
+	in.fansi, in.inFansi, in.fansiESC, in.fansiDrop = in.fansi[:0], false, false, false
+	in.vt52 = in.vt52[:0]
+	in.prev = [2]rune{}
+}
+
+// pending is whether a sequence is unfinished.
+func (in *inputState) pending() bool {
+	return !in.parser.Ground() || in.inFansi || len(in.vt52) > 0
+}
+
+// inputHandler is the parser.Handler for a Device.
+type inputHandler struct {
+	d *Device
+}
+
+// parseInput runs runes through the parser, or whatever else is to see
+// them.
+func (d *Device) parseInput(runes []rune) {
+	in := &d.input
+	if in.pending() && d.Config.SequenceTimeout > 0 && time.Since(in.last) > d.Config.SequenceTimeout {
+		if ShowUnhandled {
+			log.Warn("escape sequence timed out")
+		}
+		in.reset()
+	}
+	in.parser.MaxString = d.Config.MaxSequenceLength
+
+	h := inputHandler{d}
+	for _, r := range runes {
+		switch {
+		case d.tek.active:
+			d.tekRune(r)
+		case in.inFansi:
+			d.fansiRune(r)
+		case len(in.vt52) > 0 || (d.vt52 && r == 0x1b):
+			d.vt52Rune(r)
+		case in.prev[1] == 0x1b && r == '/':
+			// ESC / starts a fansiterm private sequence
+			in.parser.Reset()
+			h.control()
+			in.inFansi = true
+			in.fansi = in.fansi[:0]
+			in.prev = [2]rune{}
+		case in.prev == [2]rune{0x1b, ']'} && r == 'R':
+			// ESC ] R resets the linux console palette, which is
+			// ignored, and has no terminator
+			in.parser.Reset()
+			in.prev = [2]rune{}
+		default:
+			in.parser.AdvanceRune(h, r)
+			in.prev = [2]rune{in.prev[1], r}
+		}
+	}
+	d.flushText()
+
+	if d.Config.SequenceTimeout > 0 {
+		in.last = time.Now()
+	}
+}
+
+// flushText draws the text collected so far.
+func (d *Device) flushText() {
+	if len(d.input.text) > 0 {
+		d.writeText(d.input.text)
+		d.input.text = d.input.text[:0]
+	}
+}
+
+// fansiRune adds r to a fansiterm private sequence, which ends with BEL or
+// ST, or is cancelled by CAN or SUB.
+func (d *Device) fansiRune(r rune) {
+	in := &d.input
+	switch {
+	case r == 0x18 || r == 0x1a:
+		if ShowUnhandled {
+			log.Warn("aborted escape sequence", "sequence", seqString(in.fansi[:min(len(in.fansi), 32)]))
+		}
+	case r == '\a' || (in.fansiESC && r == '\\'):
+		if in.fansiDrop {
+			if ShowUnhandled {
+				log.Warn("escape sequence too long", "sequence", seqString(in.fansi[:min(len(in.fansi), 32)]))
+			}
+		} else {
+			d.handleFansiSequence(in.fansi)
+			d.updateAttr()
+		}
+	default:
+		if in.fansiESC {
+			d.fansiPut(0x1b)
+		}
+		in.fansiESC = r == 0x1b
+		if !in.fansiESC {
+			d.fansiPut(r)
+		}
+		return
+	}
+	in.inFansi, in.fansiESC, in.fansiDrop = false, false, false
+}
+
+func (d *Device) fansiPut(r rune) {
+	in := &d.input
+	if limit := d.Config.MaxSequenceLength; limit > 0 && len(in.fansi) >= limit {
+		in.fansiDrop = true
+		return
+	}
+	in.fansi = append(in.fansi, r)
+}
+
+// vt52Rune adds r to a VT52 escape sequence and handles it once it's
+// complete.
+func (d *Device) vt52Rune(r rune) {
+	in := &d.input
+	if len(in.vt52) == 0 {
+		inputHandler{d}.control()
+	}
+	if r == 0x18 || r == 0x1a {
+		in.vt52 = in.vt52[:0]
+		return
+	}
+	in.vt52 = append(in.vt52, r)
+	if n, err := consumeVT52Sequence(in.vt52); err == nil {
+		d.handleVT52Sequence(in.vt52[:n])
+		in.vt52 = in.vt52[:0]
+	}
+}
+
+// control draws any text collected so far before something else happens,
+// and ends the last grapheme cluster.
+func (h inputHandler) control() {
+	h.d.flushText()
+	h.d.cluster = lastCluster{}
+}
+
+func (h inputHandler) Print(r rune) {
+	h.d.input.text = append(h.d.input.text, r)
+}
+
+func (h inputHandler) Execute(b byte) {
+	h.control()
+	d := h.d
+	switch b {
+	case '\a': // bell
+		if d.BellFunc != nil {
+			d.BellFunc("bel")
+		}
+	case '\b': // backspace
+		// whatever is connected to the terminal needs to handle line/character editing
+		// however, when the terminal gets a backspace, that's the same as just moving cursor
+		// one space to the left. To perform a what looks like an actual backspace you must
+		// send "\b \b".
+		d.cursor.col = max(min(d.cursor.col, d.cols-1)-1, 0)
+	case '\t': // tab
+		// move cursor to the next tab stop, but don't move to next row
+		d.cursor.col = d.nextTabStop()
+	case '\r': // carriage return
+		d.cursor.col = 0
+	case '\n': // linefeed
+		d.cursor.col = 0
+		fallthrough
+	case '\v', '\f': // vertical tab and form feed (who uses either any more?!)
+		// if scroll region is not the whole screen, trying to do a new line past the end
+		// of the last row should be treated as a carriage return
+		if d.cursor.row == d.scrollRegion[1] {
+			d.Scroll(1)
+			return
+		}
+		if d.cursor.row < d.rows-1 {
+			d.cursor.row++
+		}
+	case 0x18, 0x1a: // CAN and SUB only mean something inside a sequence
+	case 0x0E: // shift out (use alt character set)
+		d.Render.active.shift = 1
+		d.updateAttr()
+	case 0x0F: // shift in (use regular char set)
+		d.Render.active.shift = 0
+		d.updateAttr()
+	}
+}
+
+func (h inputHandler) ESC(final byte, inter []byte) {
+	h.control()
+	if final == '\\' && len(inter) == 0 {
+		// ST, left over from the end of a string
+		return
+	}
+	seq := make([]rune, 0, len(inter)+2)
+	seq = append(seq, 0x1b)
+	for _, b := range inter {
+		seq = append(seq, rune(b))
+	}
+	h.d.handleEscSequence(append(seq, rune(final)))
+}
+
+func (h inputHandler) CSI(final byte, params *parser.Params, inter []byte) {
+	h.control()
+	h.d.handleCSISequence(final, params, inter)
+	h.d.updateAttr()
+}
+
+func (h inputHandler) OSC(data []byte) {
+	h.control()
+	h.d.handleOSCSequence([]rune(string(data)))
+	h.d.updateAttr()
+}
+
+func (h inputHandler) APC(data []byte) {
+	h.control()
+	h.d.handleAPCSequence([]rune(string(data)))
+	h.d.updateAttr()
+}
+
+func (h inputHandler) DCSHook(final byte, params *parser.Params, inter []byte) {
+	h.control()
+	in := &h.d.input
+	in.dcs, in.dcsDrop = in.dcs[:0], false
+	// the parameters only last until DCSHook returns
+	in.dcsFinal, in.dcsParams, in.dcsInter = final, getParams(params), string(inter)
+}
+
+func (h inputHandler) DCSPut(b byte) {
+	in := &h.d.input
+	if limit := h.d.Config.MaxSequenceLength; limit > 0 && len(in.dcs) >= limit {
+		in.dcsDrop = true
+		return
+	}
+	in.dcs = append(in.dcs, b)
+}
+
+func (h inputHandler) DCSUnhook() {
+	d := h.d
+	in := &d.input
+	switch {
+	case in.dcsDrop:
+		if ShowUnhandled {
+			log.Warn("escape sequence too long", "sequence", "DCS "+string(in.dcsFinal)+string(in.dcs[:min(len(in.dcs), 32)]))
+		}
+	default:
+		d.handleDCSSequence(in.dcsFinal, in.dcsParams, in.dcsInter, []rune(string(in.dcs)))
+		d.updateAttr()
+	}
+	in.dcs, in.dcsParams, in.dcsDrop = in.dcs[:0], nil, false
+}
+
+func (h inputHandler) Abort(err error) {
+	in := &h.d.input
+	in.dcs, in.dcsParams, in.dcsDrop = in.dcs[:0], nil, false
+	if ShowUnhandled {
+		if err == parser.ErrTooLong {
+			log.Warn("escape sequence too long")
+		} else {
+			log.Warn("aborted escape sequence")
+		}
+	}
+}
+
+// csiString is the text of a control sequence, for logging.
+func csiString(final byte, params *parser.Params, inter []byte) string {
+	seq := []byte("\x1b[")
+	i := 0
+	for ; i < len(inter) && inter[i] >= '<' && inter[i] <= '?'; i++ {
+		seq = append(seq, inter[i])
+	}
+	for j := range params.Len() {
+		if j > 0 {
+			seq = append(seq, ';')
+		}
+		for k, v := range params.Sub(j) {
+			if k > 0 {
+				seq = append(seq, ':')
+			}
+			if v >= 0 {
+				seq = strconv.AppendInt(seq, int64(v), 10)
+			}
+		}
+	}
+	seq = append(seq, inter[i:]...)
+	return seqString([]rune(string(append(seq, final))))
+}
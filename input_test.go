@@ -0,0 +1,109 @@
+package fansiterm
+
+import (
+	"image"
+	"testing"
+)
+
+func TestInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   image.Point
+	}{
+		{"csi", []string{"\x1b[3C"}, image.Pt(3, 0)},
+		{"csi split", []string{"\x1b", "[", "3", "C"}, image.Pt(3, 0)},
+		{"csi cancelled", []string{"\x1b[3\x18C"}, image.Pt(1, 0)},
+		{"csi restarted", []string{"\x1b[3\x1b[2B"}, image.Pt(0, 2)},
+		{"control in csi", []string{"\x1b[\n3C"}, image.Pt(3, 1)},
+		{"unknown esc", []string{"\x1b#8x"}, image.Pt(1, 0)},
+		{"osc", []string{"\x1b]0;ab", "c\x1b\\x"}, image.Pt(1, 0)},
+		{"apc", []string{"\x1b_Gq\ax"}, image.Pt(1, 0)},
+		{"dcs cancelled", []string{"\x1bP0;1;0q#1!3~\x18x"}, image.Pt(1, 0)},
+		{"pm", []string{"\x1b^abc\x1b\\x"}, image.Pt(1, 0)},
+		{"linux palette reset", []string{"\x1b]Rab"}, image.Pt(2, 0)},
+		{"fansi", []string{"\x1b/Xab\x1bc", "d\x1b\\x"}, image.Pt(1, 0)},
+		{"fansi cancelled", []string{"\x1b/Xab\x1a", "x"}, image.Pt(1, 0)},
+		{"vt52", []string{"\x1b[?2l\x1bY", "\x22\x25"}, image.Pt(5, 2)},
+		{"vt52 cancelled", []string{"\x1b[?2l\x1bY\x18x"}, image.Pt(1, 0)},
+	}
+	for _, tt := range tests {
+		d := New(10, 4, nil)
+		for _, w := range tt.writes {
+			d.write([]byte(w))
+		}
+		if got := image.Pt(d.cursor.col, d.cursor.row); got != tt.want {
+			t.Errorf("%s: cursor at %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInputSequenceTimeout(t *testing.T) {
+	d := New(10, 4, nil)
+	d.Config.SequenceTimeout = 1
+	d.write([]byte("\x1b[3"))
+	d.write([]byte("Cx"))
+	if d.cursor.col != 2 {
+		t.Errorf("column %d, want 2 (the timed out sequence's C printed)", d.cursor.col)
+	}
+}
+
+func TestInputTooLong(t *testing.T) {
+	for _, seq := range []string{
+		"\x1b]0;0123456789\a",
+		"\x1b_Ga=T;0123456789\x1b\\",
+		"\x1bP0;1;0q#1!3~0123456789\x1b\\",
+		"\x1b/X0123456789\x1b\\",
+	} {
+		d := New(40, 4, nil)
+		d.Config.MaxSequenceLength = 8
+		title := d.Config.Properties[PropertyWindowTitle]
+		// split the sequence so the limit is crossed in a later write
+		d.write([]byte(seq[:6]))
+		d.write([]byte(seq[6:] + "x"))
+		if d.cursor.col != 1 {
+			t.Errorf("%q: column %d, want 1 (only the x printed)", seq, d.cursor.col)
+		}
+		if got := d.Config.Properties[PropertyWindowTitle]; got != title {
+			t.Errorf("%q: title set to %q", seq, got)
+		}
+	}
+}
+
+// logRecorder is a Logger that keeps the messages it's given.
+type logRecorder struct {
+	msgs []string
+}
+
+func (l *logRecorder) Info(msg string, args ...any)  { l.msgs = append(l.msgs, "INFO "+msg) }
+func (l *logRecorder) Warn(msg string, args ...any)  { l.msgs = append(l.msgs, "WARN "+msg) }
+func (l *logRecorder) Error(msg string, args ...any) { l.msgs = append(l.msgs, "ERROR "+msg) }
+
+func TestInputLog(t *testing.T) {
+	defer func(l Logger, show bool) { log, ShowUnhandled = l, show }(log, ShowUnhandled)
+	ShowUnhandled = true
+
+	tests := []struct {
+		name, input, want string
+	}{
+		{"csi cancelled", "\x1b[1\x18", "WARN aborted escape sequence"},
+		{"osc cancelled", "\x1b]0;x\x1a", "WARN aborted escape sequence"},
+		{"apc cancelled", "\x1b_Gx\x18", "WARN aborted escape sequence"},
+		{"dcs cancelled", "\x1bPqab\x18", "WARN aborted escape sequence"},
+		{"fansi cancelled", "\x1b/Xab\x18", "WARN aborted escape sequence"},
+		{"osc too long", "\x1b]0;0123456789\a", "WARN escape sequence too long"},
+		{"apc too long", "\x1b_G0123456789\x1b\\", "WARN escape sequence too long"},
+		{"dcs too long", "\x1bPq0123456789\x1b\\", "WARN escape sequence too long"},
+		{"fansi too long", "\x1b/X0123456789\a", "WARN escape sequence too long"},
+	}
+	for _, tt := range tests {
+		rec := new(logRecorder)
+		log = rec
+		d := New(10, 4, nil)
+		d.Config.MaxSequenceLength = 8
+		d.write([]byte(tt.input))
+		if len(rec.msgs) != 1 || rec.msgs[0] != tt.want {
+			t.Errorf("%s: logged %q, want %q", tt.name, rec.msgs, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package fansiterm
+
+import (
+	"encoding/base64"
+	"image"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"github.com/sparques/fansiterm/xform"
+)
+
+// iterm2.go implements iTerm2's inline images,
+// OSC 1337 ; File=[args] : <base64 data> ST.
+// See https://iterm2.com/documentation-images.html
+//
+// Only image formats registered with the image package can be displayed; see
+// png.go, gif.go, jpeg.go and bmp.go for the build tags that pull them in.
+// As with kitty images, an image may not decode to more than the screen's
+// worth of RGBA.
+
+// handleITerm2 handles the part of an OSC 1337 sequence after the "1337;".
+func (d *Device) handleITerm2(text string) {
+	args, data, ok := strings.Cut(text, ":")
+	if !ok || !strings.HasPrefix(args, "File=") {
+		if ShowUnhandled {
+			log.Warn("unhandled iTerm2 sequence", "sequence", text)
+		}
+		return
+	}
+
+	opts := make(map[string]string)
+	for _, kv := range strings.Split(strings.TrimPrefix(args, "File="), ";") {
+		k, v, _ := strings.Cut(kv, "=")
+		opts[k] = v
+	}
+
+	// non-inline files are downloads, which there is nowhere to put
+	if opts["inline"] != "1" {
+		return
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(data)
+	var img image.Image
+	if err == nil {
+		img, err = decodeImage(raw, d.kittyMaxData())
+	}
+	if err != nil {
+		if ShowUnhandled {
+			log.Warn("could not decode iTerm2 image", "error", err)
+		}
+		return
+	}
+
+	size := d.iterm2Size(img.Bounds().Size(), opts)
+	if size.X <= 0 || size.Y <= 0 {
+		return
+	}
+
+	rect := d.placeImage(size, opts["doNotMoveCursor"] != "1")
+	var src image.Image = img
+	if size != img.Bounds().Size() {
+		src = xform.Scale(img, rect)
+	}
+	draw.Draw(d.Render, rect, src, src.Bounds().Min, draw.Over)
+}
+
+// iterm2Size works out how big to draw an image of native size from the
+// width, height and preserveAspectRatio arguments.
+func (d *Device) iterm2Size(native image.Point, opts map[string]string) image.Point {
+	if native.X <= 0 || native.Y <= 0 {
+		return image.Point{}
+	}
+	screen := d.Render.Bounds().Size()
+	w, wAuto := iterm2Dimension(opts["width"], d.Render.cell.Dx(), screen.X)
+	h, hAuto := iterm2Dimension(opts["height"], d.Render.cell.Dy(), screen.Y)
+
+	switch {
+	case wAuto && hAuto:
+		w, h = native.X, native.Y
+		// like iTerm2, shrink automatically sized images to fit the width
+		if w > screen.X {
+			w, h = screen.X, h*screen.X/w
+		}
+	case wAuto:
+		w = native.X * h / native.Y
+	case hAuto:
+		h = native.Y * w / native.X
+	case opts["preserveAspectRatio"] != "0":
+		// fit within w x h, keeping the aspect ratio
+		if w*native.Y < h*native.X {
+			h = native.Y * w / native.X
+		} else {
+			w = native.X * h / native.Y
+		}
+	}
+
+	return image.Pt(w, h)
+}
+
+// iterm2Dimension converts a width or height argument to pixels. A plain
+// number is in cells, and can also be given as Npx, N% of the terminal's size,
+// or auto.
+func iterm2Dimension(spec string, cell, total int) (px int, auto bool) {
+	var err error
+	switch {
+	case spec == "" || spec == "auto":
+		return 0, true
+	case strings.HasSuffix(spec, "px"):
+		px, err = strconv.Atoi(strings.TrimSuffix(spec, "px"))
+	case strings.HasSuffix(spec, "%"):
+		px, err = strconv.Atoi(strings.TrimSuffix(spec, "%"))
+		px = total * px / 100
+	default:
+		px, err = strconv.Atoi(spec)
+		px *= cell
+	}
+	if err != nil || px <= 0 {
+		return 0, true
+	}
+	return px, false
+}
@@ -0,0 +1,96 @@
+package fansiterm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestITerm2Dimension(t *testing.T) {
+	tests := []struct {
+		spec     string
+		wantPx   int
+		wantAuto bool
+	}{
+		{"", 0, true},
+		{"auto", 0, true},
+		{"10", 80, false},
+		{"50px", 50, false},
+		{"25%", 200, false},
+		{"0", 0, true},
+		{"-3", 0, true},
+		{"wide", 0, true},
+		{"xpx", 0, true},
+	}
+	for _, tt := range tests {
+		px, auto := iterm2Dimension(tt.spec, 8, 800)
+		if px != tt.wantPx || auto != tt.wantAuto {
+			t.Errorf("iterm2Dimension(%q) = %d, %v, want %d, %v", tt.spec, px, auto, tt.wantPx, tt.wantAuto)
+		}
+	}
+}
+
+func TestITerm2Size(t *testing.T) {
+	// 800x480 pixels of 8x16 cells
+	d := New(100, 30, nil)
+	tests := []struct {
+		name   string
+		native image.Point
+		opts   string
+		want   image.Point
+	}{
+		{"native", image.Pt(200, 100), "", image.Pt(200, 100)},
+		{"auto", image.Pt(200, 100), "width=auto;height=auto", image.Pt(200, 100)},
+		{"shrunk to fit", image.Pt(1600, 400), "", image.Pt(800, 200)},
+		{"cells wide", image.Pt(200, 100), "width=10", image.Pt(80, 40)},
+		{"cells high", image.Pt(200, 100), "height=5", image.Pt(160, 80)},
+		{"pixels", image.Pt(200, 100), "width=100px", image.Pt(100, 50)},
+		{"percent", image.Pt(200, 100), "width=50%", image.Pt(400, 200)},
+		{"aspect kept", image.Pt(200, 100), "width=100px;height=100px", image.Pt(100, 50)},
+		{"aspect kept tall", image.Pt(100, 200), "width=100px;height=100px", image.Pt(50, 100)},
+		{"aspect explicit", image.Pt(200, 100), "width=100px;height=100px;preserveAspectRatio=1", image.Pt(100, 50)},
+		{"stretched", image.Pt(200, 100), "width=100px;height=100px;preserveAspectRatio=0", image.Pt(100, 100)},
+		{"empty", image.Pt(0, 100), "", image.Pt(0, 0)},
+	}
+	for _, tt := range tests {
+		opts := make(map[string]string)
+		for _, kv := range strings.Split(tt.opts, ";") {
+			k, v, _ := strings.Cut(kv, "=")
+			opts[k] = v
+		}
+		if got := d.iterm2Size(tt.native, opts); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestITerm2Cursor(t *testing.T) {
+	var buf bytes.Buffer
+	// two cells wide and not quite two high
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 16, 20)))
+	img := base64.StdEncoding.EncodeToString(buf.Bytes())
+	big := base64.StdEncoding.EncodeToString(claimPNG(t, 8000, 8000))
+
+	tests := []struct {
+		name string
+		seq  string
+		want image.Point
+	}{
+		{"moved", "\x1b[2;3H\x1b]1337;File=inline=1:" + img + "\a", image.Pt(4, 2)},
+		{"not moved", "\x1b[2;3H\x1b]1337;File=inline=1;doNotMoveCursor=1:" + img + "\a", image.Pt(2, 1)},
+		{"not inline", "\x1b[2;3H\x1b]1337;File=name=eA==:" + img + "\a", image.Pt(2, 1)},
+		{"too big", "\x1b[2;3H\x1b]1337;File=inline=1:" + big + "\a", image.Pt(2, 1)},
+		// three rows high makes it 38 pixels, five cells, wide
+		{"scrolled", "\x1b[4;1H\x1b]1337;File=inline=1;height=3:" + img + "\a", image.Pt(5, 3)},
+	}
+	for _, tt := range tests {
+		d := New(10, 4, nil)
+		d.write([]byte(tt.seq))
+		if got := image.Pt(d.cursor.col, d.cursor.row); got != tt.want {
+			t.Errorf("%s: cursor at %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package fansiterm
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+// keyboard.go turns key presses into the bytes a program running on the
+// terminal expects to read, following xterm. What a key sends depends on the
+// modes the program has set: cursor key mode (DECCKM), keypad mode (ESC = and
+// ESC >), modifyOtherKeys (CSI > 4 ; n m) and VT52 mode.
+
+// KeyCode identifies a key.
+type KeyCode int
+
+const (
+	// KeyRune is a key that types a character, given by Key.Rune.
+	KeyRune KeyCode = iota
+	KeyEnter
+	KeyTab
+	KeyBackspace
+	KeyEscape
+
+	KeyUp
+	KeyDown
+	KeyRight
+	KeyLeft
+	KeyHome
+	KeyEnd
+	KeyInsert
+	KeyDelete
+	KeyPageUp
+	KeyPageDown
+
+	// KeyF1 through KeyF24 are consecutive, so Fn is KeyF1 + n - 1.
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+	KeyF13
+	KeyF14
+	KeyF15
+	KeyF16
+	KeyF17
+	KeyF18
+	KeyF19
+	KeyF20
+	KeyF21
+	KeyF22
+	KeyF23
+	KeyF24
+
+	// The numeric keypad. KeyKP0 through KeyKP9 are consecutive.
+	KeyKP0
+	KeyKP1
+	KeyKP2
+	KeyKP3
+	KeyKP4
+	KeyKP5
+	KeyKP6
+	KeyKP7
+	KeyKP8
+	KeyKP9
+	KeyKPDecimal
+	KeyKPDivide
+	KeyKPMultiply
+	KeyKPSubtract
+	KeyKPAdd
+	KeyKPEnter
+	KeyKPEqual
+	KeyKPSeparator
+)
+
+// Modifier is a set of modifier keys held down.
+type Modifier uint8
+
+const (
+	ModShift Modifier = 1 << iota
+	ModAlt
+	ModCtrl
+	ModMeta
+	_
+	_
+	// ModCapsLock and ModNumLock are only reported by the kitty keyboard
+	// protocol.
+	ModCapsLock
+	ModNumLock
+)
+
+// KeyEvent is whether a key was pressed, is repeating or was released.
+// Repeats and releases are only reported by the kitty keyboard protocol;
+// otherwise a repeat is sent as another press and a release sends nothing.
+type KeyEvent int
+
+const (
+	KeyPress KeyEvent = iota
+	KeyRepeat
+	KeyRelease
+)
+
+// Key is a key press.
+type Key struct {
+	Code KeyCode
+	// Rune is the character typed for KeyRune, with Shift (and any other
+	// layout level) already applied, e.g. 'A' for Shift+a. Ctrl and Alt are
+	// given by Mod instead.
+	Rune rune
+	Mod  Modifier
+	// Event defaults to KeyPress.
+	Event KeyEvent
+	// Base is the character of a KeyRune key without Shift, e.g. 'a' for
+	// Shift+a, and Layout what the key would type in the US layout, e.g. 'c'
+	// for the Cyrillic с. They're only used by the kitty keyboard protocol;
+	// if zero, Base is Rune in lower case and Layout is Base.
+	Base, Layout rune
+}
+
+// cursorKeyFinals are the final characters of the cursor and Home/End keys.
+var cursorKeyFinals = map[KeyCode]byte{
+	KeyUp: 'A', KeyDown: 'B', KeyRight: 'C', KeyLeft: 'D', KeyHome: 'H', KeyEnd: 'F',
+}
+
+// tildeKeys are the keys sent as CSI n ~.
+var tildeKeys = map[KeyCode]int{
+	KeyInsert: 2, KeyDelete: 3, KeyPageUp: 5, KeyPageDown: 6,
+	KeyF5: 15, KeyF6: 17, KeyF7: 18, KeyF8: 19, KeyF9: 20, KeyF10: 21, KeyF11: 23, KeyF12: 24,
+}
+
+// keypadKeys gives, for each keypad key other than the digits, the
+// character it types in numeric mode and the final character of its SS3
+// sequence in application mode.
+var keypadKeys = map[KeyCode][2]byte{
+	KeyKPDecimal: {'.', 'n'}, KeyKPDivide: {'/', 'o'}, KeyKPMultiply: {'*', 'j'},
+	KeyKPSubtract: {'-', 'm'}, KeyKPAdd: {'+', 'k'}, KeyKPEnter: {'\r', 'M'},
+	KeyKPEqual: {'=', 'X'}, KeyKPSeparator: {',', 'l'},
+}
+
+// EncodeKey returns what the terminal sends to the host for k, given the
+// current modes. It returns nil for keys that send nothing.
+func (d *Device) EncodeKey(k Key) []byte {
+	d.Lock()
+	defer d.Unlock()
+	return d.encodeKey(k)
+}
+
+// SendKey writes what the terminal sends for k to Output. Keys always use
+// 7-bit escape sequences; S8C1T only changes how replies are sent.
+func (d *Device) SendKey(k Key) error {
+	d.Lock()
+	defer d.Unlock()
+	seq := d.encodeKey(k)
+	if len(seq) == 0 {
+		return nil
+	}
+	_, err := d.Output.Write(seq)
+	return err
+}
+
+// modParam is the xterm modifier parameter: 1 plus a bit for each modifier.
+func modParam(mod Modifier) int {
+	return 1 + int(mod)
+}
+
+func (d *Device) encodeKey(k Key) []byte {
+	if flags := d.keyFlags(); flags != 0 && !d.vt52 {
+		return d.encodeKittyKey(k, flags)
+	}
+	if k.Event == KeyRelease {
+		return nil
+	}
+	// the lock keys aren't reported
+	k.Mod &= ModShift | ModAlt | ModCtrl | ModMeta
+	if d.vt52 {
+		return d.encodeVT52Key(k)
+	}
+
+	// F13-F24 are sent as Shift+F1-F12
+	if k.Code >= KeyF13 && k.Code <= KeyF24 {
+		k.Code -= KeyF13 - KeyF1
+		k.Mod |= ModShift
+	}
+
+	if final, ok := cursorKeyFinals[k.Code]; ok {
+		switch {
+		case k.Mod != 0:
+			return csiKey(1, k.Mod, final)
+		case d.Config.CursorKeyApplicationMode:
+			return []byte{0x1b, 'O', final}
+		default:
+			return []byte{0x1b, '[', final}
+		}
+	}
+	if k.Code >= KeyF1 && k.Code <= KeyF4 {
+		final := 'P' + byte(k.Code-KeyF1)
+		if k.Mod != 0 {
+			return csiKey(1, k.Mod, final)
+		}
+		return []byte{0x1b, 'O', final}
+	}
+	if n, ok := tildeKeys[k.Code]; ok {
+		if k.Mod != 0 {
+			return csiKey(n, k.Mod, '~')
+		}
+		return []byte("\x1b[" + strconv.Itoa(n) + "~")
+	}
+
+	if k.Code >= KeyKP0 && k.Code <= KeyKPSeparator {
+		var ch, app byte
+		if k.Code <= KeyKP9 {
+			ch, app = '0'+byte(k.Code-KeyKP0), 'p'+byte(k.Code-KeyKP0)
+		} else {
+			ch, app = keypadKeys[k.Code][0], keypadKeys[k.Code][1]
+		}
+		if d.Config.KeypadApplicationMode && k.Mod == 0 {
+			return []byte{0x1b, 'O', app}
+		}
+		if ch == '\r' {
+			k.Code = KeyEnter
+		} else {
+			k.Code, k.Rune = KeyRune, rune(ch)
+		}
+	}
+
+	return d.encodeOtherKey(k)
+}
+
+// csiKey is CSI n ; mod final, the form of a modified function key.
+func csiKey(n int, mod Modifier, final byte) []byte {
+	return []byte("\x1b[" + strconv.Itoa(n) + ";" + strconv.Itoa(modParam(mod)) + string(final))
+}
+
+// encodeOtherKey encodes characters and the keys that send control
+// characters.
+func (d *Device) encodeOtherKey(k Key) []byte {
+	var code rune
+	switch k.Code {
+	case KeyRune:
+		code = k.Rune
+	case KeyEnter:
+		code = '\r'
+	case KeyTab:
+		code = '\t'
+	case KeyBackspace:
+		code = 0x7f
+	case KeyEscape:
+		code = 0x1b
+	default:
+		return nil
+	}
+
+	if d.modifyOtherKey(k, code) {
+		return []byte("\x1b[27;" + strconv.Itoa(modParam(k.Mod)) + ";" + strconv.Itoa(int(code)) + "~")
+	}
+
+	switch {
+	case k.Code == KeyTab && k.Mod&ModShift != 0:
+		return []byte("\x1b[Z")
+	case k.Code == KeyBackspace && k.Mod&ModCtrl != 0:
+		code = '\b'
+	case k.Mod&ModCtrl != 0:
+		if c, ok := ctrlRune(code); ok {
+			code = c
+		}
+	}
+
+	var seq []byte
+	if k.Mod&(ModAlt|ModMeta) != 0 {
+		// meta sends escape
+		seq = append(seq, 0x1b)
+	}
+	return utf8.AppendRune(seq, code)
+}
+
+// modifyOtherKey is whether modifyOtherKeys applies to k, which would
+// otherwise send code.
+func (d *Device) modifyOtherKey(k Key, code rune) bool {
+	mod := k.Mod
+	if k.Code == KeyRune {
+		// Shift is already part of the character
+		mod &^= ModShift
+	}
+	switch {
+	case mod == 0 || d.vt52:
+		return false
+	case k.Code == KeyTab && mod == ModShift:
+		// back tab has a sequence of its own
+		return false
+	case d.Config.ModifyOtherKeys >= 2:
+		return true
+	case d.Config.ModifyOtherKeys == 1:
+		// only the combinations that can't be told apart otherwise
+		if k.Code != KeyRune {
+			return k.Mod&ModCtrl != 0
+		}
+		_, ok := ctrlRune(code)
+		return mod&ModCtrl != 0 && (!ok || k.Mod&ModShift != 0)
+	}
+	return false
+}
+
+// ctrlRune is the control character typed by Ctrl and r, if there is one.
+func ctrlRune(r rune) (rune, bool) {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return r - 'a' + 1, true
+	case r >= '@' && r <= '_':
+		return r - '@', true
+	case r == ' ' || r == '2':
+		return 0, true
+	case r >= '3' && r <= '7':
+		return r - '3' + 0x1b, true
+	case r == '8' || r == '?':
+		return 0x7f, true
+	case r == '/':
+		return 0x1f, true
+	}
+	return 0, false
+}
+
+// encodeVT52Key encodes k the way a VT52 sends it: no modifiers, and ESC and
+// a single character for the cursor and function keys.
+func (d *Device) encodeVT52Key(k Key) []byte {
+	switch {
+	case k.Code >= KeyUp && k.Code <= KeyLeft:
+		return []byte{0x1b, cursorKeyFinals[k.Code]}
+	case k.Code >= KeyF1 && k.Code <= KeyF4:
+		return []byte{0x1b, 'P' + byte(k.Code-KeyF1)}
+	case k.Code >= KeyKP0 && k.Code <= KeyKPSeparator && d.Config.KeypadApplicationMode:
+		if k.Code <= KeyKP9 {
+			return []byte{0x1b, '?', 'p' + byte(k.Code-KeyKP0)}
+		}
+		return []byte{0x1b, '?', keypadKeys[k.Code][1]}
+	case k.Code >= KeyKP0 && k.Code <= KeyKP9:
+		return []byte{'0' + byte(k.Code-KeyKP0)}
+	case k.Code >= KeyKPDecimal && k.Code <= KeyKPSeparator:
+		return []byte{keypadKeys[k.Code][0]}
+	}
+	k.Mod &= ModCtrl
+	return d.encodeOtherKey(k)
+}
@@ -0,0 +1,57 @@
+package fansiterm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup string
+		key   Key
+		want  string
+	}{
+		{"rune", "", Key{Rune: 'a'}, "a"},
+		{"ctrl", "", Key{Rune: 'a', Mod: ModCtrl}, "\x01"},
+		{"alt", "", Key{Rune: 'x', Mod: ModAlt}, "\x1bx"},
+		{"release", "", Key{Rune: 'a', Event: KeyRelease}, ""},
+		{"cursor", "", Key{Code: KeyUp}, "\x1b[A"},
+		{"cursor application", "\x1b[?1h", Key{Code: KeyUp}, "\x1bOA"},
+		{"cursor shift", "\x1b[?1h", Key{Code: KeyUp, Mod: ModShift}, "\x1b[1;2A"},
+		{"f1", "", Key{Code: KeyF1}, "\x1bOP"},
+		{"f5", "", Key{Code: KeyF5}, "\x1b[15~"},
+		{"f5 ctrl", "", Key{Code: KeyF5, Mod: ModCtrl}, "\x1b[15;5~"},
+		{"f13", "", Key{Code: KeyF13}, "\x1b[1;2P"},
+		{"back tab", "", Key{Code: KeyTab, Mod: ModShift}, "\x1b[Z"},
+		{"keypad numeric", "", Key{Code: KeyKP5}, "5"},
+		{"keypad enter", "", Key{Code: KeyKPEnter}, "\r"},
+		{"keypad application", "\x1b=", Key{Code: KeyKP5}, "\x1bOu"},
+		{"modifyOtherKeys 1", "\x1b[>4;1m", Key{Rune: 'a', Mod: ModCtrl}, "\x01"},
+		{"modifyOtherKeys 1 no control", "\x1b[>4;1m", Key{Rune: '1', Mod: ModCtrl}, "\x1b[27;5;49~"},
+		{"modifyOtherKeys 2", "\x1b[>4;2m", Key{Rune: 'a', Mod: ModCtrl}, "\x1b[27;5;97~"},
+		{"vt52 cursor", "\x1b[?2l", Key{Code: KeyUp}, "\x1bA"},
+		{"vt52 keypad application", "\x1b[?2l\x1b=", Key{Code: KeyKP5}, "\x1b?u"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(10, 4, nil)
+			d.write([]byte(tt.setup))
+			if got := string(d.EncodeKey(tt.key)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendKey8BitControls(t *testing.T) {
+	d := New(10, 4, nil)
+	var out bytes.Buffer
+	d.Output = &out
+	d.write([]byte("\x1b G"))
+	d.SendKey(Key{Code: KeyUp})
+	d.SendKey(Key{Rune: 'A', Mod: ModAlt})
+	if got, want := out.String(), "\x1b[A\x1bA"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
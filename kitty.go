@@ -0,0 +1,537 @@
+package fansiterm
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"strconv"
+
+	"github.com/sparques/fansiterm/xform"
+)
+
+// kitty.go implements the kitty terminal graphics protocol,
+// APC G <control data> ; <payload> ST.
+// See https://sw.kovidgoyal.net/kitty/graphics-protocol/
+//
+// Only direct transmission (t=d) is supported; there is no file system to
+// read from on a microcontroller. Placements are drawn straight to Render and
+// are not re-rendered when the screen scrolls.
+
+// kittyMaxImages caps how many transmitted images are kept around. The oldest
+// is forgotten when a new one would go over.
+const kittyMaxImages = 16
+
+// kittyMaxData is how many bytes of image data, per pixel of the screen, a
+// transmission may use. This bounds the chunks of a transmission, the result
+// of decompressing it and the size of the image a PNG decodes to: an RGBA
+// image the size of the screen fits.
+const kittyMaxData = 4
+
+// kittyGraphics is the kitty graphics protocol state of a Device.
+type kittyGraphics struct {
+	images map[uint32]*kittyImage
+	// order tracks image ids from oldest to newest, for eviction.
+	order      []uint32
+	placements []kittyPlacement
+	// pending is a chunked transmission (m=1) in progress.
+	pending *kittyCommand
+	data    []byte
+	// discard is set when a chunked transmission has been dropped, until
+	// its last chunk arrives.
+	discard bool
+	nextID  uint32
+}
+
+type kittyImage struct {
+	image.Image
+	number uint32
+}
+
+// kittyPlacement records where an image was drawn so it can be deleted.
+type kittyPlacement struct {
+	id, placement uint32
+	rect          image.Rectangle
+}
+
+// kittyCommand holds the parsed control data of a graphics command.
+type kittyCommand struct {
+	action      rune   // a: t, T, p, d, q
+	quiet       int    // q: 1 suppresses OK, 2 suppresses errors too
+	format      int    // f: 24, 32 or 100 (PNG)
+	medium      rune   // t: only d (direct) is supported
+	compression rune   // o: z for zlib
+	more        bool   // m: more chunks follow
+	id          uint32 // i
+	number      uint32 // I
+	placement   uint32 // p
+	width       int    // s: pixel width of raw data
+	height      int    // v: pixel height of raw data
+	src         image.Rectangle
+	cols, rows  int         // c, r: display size in cells
+	offset      image.Point // X, Y: pixel offset within the first cell
+	noMove      bool        // C=1: don't move the cursor
+	delete      rune        // d: what to delete
+}
+
+var (
+	errKittyNoEntry = errors.New("ENOENT:image not found")
+	errKittyTooBig  = errors.New("EFBIG:image too large")
+)
+
+func parseKittyCommand(control []rune) (cmd kittyCommand) {
+	cmd.action = 't'
+	cmd.format = 32
+	cmd.medium = 'd'
+	cmd.delete = 'a'
+	for _, kv := range splitOn(control, ',') {
+		if len(kv) < 3 || kv[1] != '=' {
+			continue
+		}
+		key, value := kv[0], kv[2:]
+		n, _ := strconv.Atoi(string(value))
+		switch key {
+		case 'a':
+			cmd.action = value[0]
+		case 'q':
+			cmd.quiet = n
+		case 'f':
+			cmd.format = n
+		case 't':
+			cmd.medium = value[0]
+		case 'o':
+			cmd.compression = value[0]
+		case 'm':
+			cmd.more = n == 1
+		case 'i':
+			cmd.id = uint32(n)
+		case 'I':
+			cmd.number = uint32(n)
+		case 'p':
+			cmd.placement = uint32(n)
+		case 's':
+			cmd.width = n
+		case 'v':
+			cmd.height = n
+		case 'x':
+			cmd.src.Min.X = n
+		case 'y':
+			cmd.src.Min.Y = n
+		case 'w':
+			cmd.src.Max.X = n
+		case 'h':
+			cmd.src.Max.Y = n
+		case 'c':
+			cmd.cols = n
+		case 'r':
+			cmd.rows = n
+		case 'X':
+			cmd.offset.X = n
+		case 'Y':
+			cmd.offset.Y = n
+		case 'C':
+			cmd.noMove = n == 1
+		case 'd':
+			cmd.delete = value[0]
+		}
+	}
+	// w and h are sizes, not coordinates
+	cmd.src.Max = cmd.src.Max.Add(cmd.src.Min)
+	return
+}
+
+// splitOn is splitParams with an arbitrary separator.
+func splitOn(data []rune, sep rune) (split [][]rune) {
+	prev := 0
+	for i := range data {
+		if data[i] == sep {
+			split = append(split, data[prev:i])
+			prev = i + 1
+		}
+	}
+	return append(split, data[prev:])
+}
+
+// handleKittyGraphics handles a kitty graphics command. seq is everything
+// after the G.
+func (d *Device) handleKittyGraphics(seq []rune) {
+	control, payload := seq, []rune(nil)
+	for i := range seq {
+		if seq[i] == ';' {
+			control, payload = seq[:i], seq[i+1:]
+			break
+		}
+	}
+
+	if d.kitty.discard {
+		d.kitty.discard = parseKittyCommand(control).more
+		return
+	}
+
+	data, err := decodeKittyPayload(payload)
+
+	// continuation of a chunked transmission; only m (and maybe q) are sent
+	if d.kitty.pending != nil {
+		cmd := d.kitty.pending
+		if err != nil {
+			d.kitty.pending, d.kitty.data = nil, nil
+			d.kitty.discard = parseKittyCommand(control).more
+			d.kittyReply(cmd, fmt.Errorf("EINVAL:%w", err))
+			return
+		}
+		if len(d.kitty.data)+len(data) > d.kittyMaxData() {
+			d.kitty.pending, d.kitty.data = nil, nil
+			d.kitty.discard = parseKittyCommand(control).more
+			d.kittyReply(cmd, errKittyTooBig)
+			return
+		}
+		d.kitty.data = append(d.kitty.data, data...)
+		if parseKittyCommand(control).more {
+			return
+		}
+		data = d.kitty.data
+		d.kitty.pending, d.kitty.data = nil, nil
+		d.kittyTransmit(cmd, data)
+		return
+	}
+
+	cmd := parseKittyCommand(control)
+	switch cmd.action {
+	case 't', 'T', 'q':
+		if cmd.medium != 'd' {
+			d.kittyReply(&cmd, errors.New("EINVAL:only direct transmission is supported"))
+			return
+		}
+		if err != nil {
+			d.kittyReply(&cmd, fmt.Errorf("EINVAL:%w", err))
+			return
+		}
+		if len(data) > d.kittyMaxData() {
+			d.kitty.discard = cmd.more
+			d.kittyReply(&cmd, errKittyTooBig)
+			return
+		}
+		if cmd.more {
+			d.kitty.pending = &cmd
+			d.kitty.data = data
+			return
+		}
+		d.kittyTransmit(&cmd, data)
+	case 'p':
+		id := d.kittyLookup(&cmd)
+		img, ok := d.kitty.images[id]
+		if !ok {
+			d.kittyReply(&cmd, errKittyNoEntry)
+			return
+		}
+		d.kittyDisplay(&cmd, id, img)
+		d.kittyReply(&cmd, nil)
+	case 'd':
+		d.kittyDelete(&cmd)
+	default:
+		d.kittyReply(&cmd, errors.New("EINVAL:unsupported action"))
+	}
+}
+
+// kittyMaxData is the most image data, in bytes, a transmission may use.
+func (d *Device) kittyMaxData() int {
+	return d.Render.bounds.Dx() * d.Render.bounds.Dy() * kittyMaxData
+}
+
+func decodeKittyPayload(payload []rune) ([]byte, error) {
+	if len(payload) == 0 {
+		return nil, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(string(payload))
+	if err != nil {
+		return base64.RawStdEncoding.DecodeString(string(payload))
+	}
+	return data, nil
+}
+
+// kittyTransmit decodes a completely received image and then stores it,
+// displays it, or (for a query) just reports whether it could be decoded.
+func (d *Device) kittyTransmit(cmd *kittyCommand, data []byte) {
+	img, err := decodeKittyImage(cmd, data, d.kittyMaxData())
+	if err != nil {
+		d.kittyReply(cmd, err)
+		return
+	}
+	if cmd.action == 'q' {
+		d.kittyReply(cmd, nil)
+		return
+	}
+
+	id := cmd.id
+	if id == 0 {
+		id = d.kittyNewID()
+		// the assigned id is only reported back if an image number was used
+		if cmd.number != 0 {
+			cmd.id = id
+		}
+	}
+	d.kittyStore(id, &kittyImage{Image: img, number: cmd.number})
+
+	if cmd.action == 'T' {
+		d.kittyDisplay(cmd, id, d.kitty.images[id])
+	}
+	d.kittyReply(cmd, nil)
+}
+
+// decodeKittyImage decodes the data of a transmission. Raw pixel data may not
+// be more than limit bytes, nor may compressed data decompress to more, nor a
+// PNG be larger than that as RGBA.
+func decodeKittyImage(cmd *kittyCommand, data []byte, limit int) (image.Image, error) {
+	if cmd.format != 100 && cmd.width > 0 && cmd.height > 0 {
+		if cmd.height > limit/4/cmd.width {
+			return nil, errKittyTooBig
+		}
+		// raw data can't usefully be any longer than the image is
+		limit = cmd.width * cmd.height * 4
+	}
+	if cmd.compression == 'z' {
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("EINVAL:%w", err)
+		}
+		// read one byte past the limit to find out if it's exceeded
+		data, err = io.ReadAll(io.LimitReader(zr, int64(limit)+1))
+		if err != nil {
+			return nil, fmt.Errorf("EINVAL:%w", err)
+		}
+		if len(data) > limit {
+			return nil, errKittyTooBig
+		}
+	}
+
+	rect := image.Rect(0, 0, cmd.width, cmd.height)
+	switch cmd.format {
+	case 100:
+		img, err := decodeImage(data, limit)
+		switch {
+		case err == errImageTooBig:
+			return nil, errKittyTooBig
+		case err != nil:
+			return nil, fmt.Errorf("EBADPNG:%w", err)
+		}
+		return img, nil
+	case 24:
+		if rect.Empty() || len(data) < rect.Dx()*rect.Dy()*3 {
+			return nil, errors.New("ENODATA:insufficient image data")
+		}
+		return &RGBImage{Pix: data[:rect.Dx()*rect.Dy()*3], Rectangle: rect}, nil
+	case 32:
+		if rect.Empty() || len(data) < rect.Dx()*rect.Dy()*4 {
+			return nil, errors.New("ENODATA:insufficient image data")
+		}
+		return &image.NRGBA{Pix: data[:rect.Dx()*rect.Dy()*4], Stride: rect.Dx() * 4, Rect: rect}, nil
+	default:
+		return nil, errors.New("EINVAL:unknown format")
+	}
+}
+
+// kittyNewID picks an unused image id for images sent with only a number.
+func (d *Device) kittyNewID() uint32 {
+	for {
+		d.kitty.nextID++
+		// stay clear of the small ids applications are likely to pick
+		if d.kitty.nextID < 1<<24 {
+			d.kitty.nextID = 1 << 24
+		}
+		if _, ok := d.kitty.images[d.kitty.nextID]; !ok {
+			return d.kitty.nextID
+		}
+	}
+}
+
+func (d *Device) kittyStore(id uint32, img *kittyImage) {
+	if d.kitty.images == nil {
+		d.kitty.images = make(map[uint32]*kittyImage)
+	}
+	if _, ok := d.kitty.images[id]; ok {
+		d.kittyForget(id)
+	}
+	if len(d.kitty.order) >= kittyMaxImages {
+		d.kittyForget(d.kitty.order[0])
+	}
+	d.kitty.images[id] = img
+	d.kitty.order = append(d.kitty.order, id)
+}
+
+func (d *Device) kittyForget(id uint32) {
+	delete(d.kitty.images, id)
+	for i := range d.kitty.order {
+		if d.kitty.order[i] == id {
+			d.kitty.order = append(d.kitty.order[:i], d.kitty.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// kittyLookup resolves the image a command refers to, by id or, failing
+// that, the newest image with the given number.
+func (d *Device) kittyLookup(cmd *kittyCommand) uint32 {
+	if cmd.id != 0 || cmd.number == 0 {
+		return cmd.id
+	}
+	for i := len(d.kitty.order) - 1; i >= 0; i-- {
+		if d.kitty.images[d.kitty.order[i]].number == cmd.number {
+			cmd.id = d.kitty.order[i]
+			return cmd.id
+		}
+	}
+	return 0
+}
+
+// kittyDisplay draws img at the cursor. The image is scaled if the command
+// asks for a size in cells; if only one of columns or rows is given, the
+// aspect ratio is kept.
+func (d *Device) kittyDisplay(cmd *kittyCommand, id uint32, img *kittyImage) {
+	var src image.Image = img
+	if !cmd.src.Empty() {
+		src = xform.Crop(img, cmd.src.Add(img.Bounds().Min))
+	}
+	if src.Bounds().Empty() {
+		return
+	}
+
+	cell := d.Render.cell.Size()
+	size := src.Bounds().Size()
+	switch {
+	case cmd.cols > 0 && cmd.rows > 0:
+		size = image.Pt(cmd.cols*cell.X, cmd.rows*cell.Y)
+	case cmd.cols > 0:
+		size = image.Pt(cmd.cols*cell.X, src.Bounds().Dy()*cmd.cols*cell.X/src.Bounds().Dx())
+	case cmd.rows > 0:
+		size = image.Pt(src.Bounds().Dx()*cmd.rows*cell.Y/src.Bounds().Dy(), cmd.rows*cell.Y)
+	}
+
+	rect := d.placeImage(size.Add(cmd.offset), !cmd.noMove)
+	rect.Min = rect.Min.Add(cmd.offset)
+
+	if size != src.Bounds().Size() {
+		src = xform.Scale(src, rect)
+	}
+	draw.Draw(d.Render, rect, src, src.Bounds().Min, draw.Over)
+
+	d.kitty.placements = append(d.kitty.placements, kittyPlacement{
+		id:        id,
+		placement: cmd.placement,
+		rect:      rect,
+	})
+}
+
+// placeImage works out where an image of size pixels goes when drawn at the
+// cursor, scrolling the screen up if it would run off the bottom. If move is
+// set, the cursor is left in the cell following the image's bottom right
+// corner, the way kitty and iTerm2 do it.
+func (d *Device) placeImage(size image.Point, move bool) image.Rectangle {
+	cell := d.Render.cell.Size()
+	cols := (size.X + cell.X - 1) / cell.X
+	rows := max((size.Y+cell.Y-1)/cell.Y, 1)
+
+	if over := d.cursor.row + rows - 1 - d.scrollRegion[1]; over > 0 && move {
+		d.Scroll(over)
+		d.cursor.row -= over
+	}
+
+	rect := image.Rectangle{Max: size}.Add(d.cursorPt())
+
+	if move {
+		d.cursor.row = bound(d.cursor.row+rows-1, 0, d.rows-1)
+		d.cursor.col = bound(d.cursor.col+cols, 0, d.cols-1)
+	}
+
+	return rect
+}
+
+func (d *Device) kittyDelete(cmd *kittyCommand) {
+	var match func(p kittyPlacement) bool
+	switch cmd.delete {
+	case 'a', 'A':
+		match = func(kittyPlacement) bool { return true }
+	case 'i', 'I', 'n', 'N':
+		id := d.kittyLookup(cmd)
+		match = func(p kittyPlacement) bool {
+			return p.id == id && (cmd.placement == 0 || p.placement == cmd.placement)
+		}
+	case 'c', 'C':
+		cursor := image.Rectangle{Max: d.Render.cell.Size()}.Add(d.cursorPt())
+		match = func(p kittyPlacement) bool { return p.rect.Overlaps(cursor) }
+	default:
+		return
+	}
+
+	// upper case also frees the image data, once nothing shows it any more
+	free := cmd.delete >= 'A' && cmd.delete <= 'Z'
+
+	var freed []uint32
+	kept := d.kitty.placements[:0]
+	for _, p := range d.kitty.placements {
+		if !match(p) {
+			kept = append(kept, p)
+			continue
+		}
+		d.Render.Fill(p.rect, d.attr.Bg)
+		if free {
+			freed = append(freed, p.id)
+		}
+	}
+	d.kitty.placements = kept
+
+	if free && (cmd.delete == 'I' || cmd.delete == 'N') {
+		freed = append(freed, d.kittyLookup(cmd))
+	}
+	for _, id := range freed {
+		if !d.kittyPlaced(id) {
+			d.kittyForget(id)
+		}
+	}
+	if cmd.delete == 'A' {
+		d.kitty.images = nil
+		d.kitty.order = nil
+	}
+}
+
+// kittyPlaced reports whether image id is still shown anywhere.
+func (d *Device) kittyPlaced(id uint32) bool {
+	for _, p := range d.kitty.placements {
+		if p.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// kittyReply sends the response to a command. Like kitty, nothing is sent if
+// the command didn't include an image id or number.
+func (d *Device) kittyReply(cmd *kittyCommand, err error) {
+	if cmd.id == 0 && cmd.number == 0 {
+		return
+	}
+	if (err == nil && cmd.quiet >= 1) || cmd.quiet >= 2 {
+		return
+	}
+	msg := "OK"
+	if err != nil {
+		msg = err.Error()
+	}
+	fmt.Fprintf(d.output(), "\x1b_G")
+	if cmd.id != 0 {
+		fmt.Fprintf(d.output(), "i=%d", cmd.id)
+	}
+	if cmd.number != 0 {
+		if cmd.id != 0 {
+			fmt.Fprintf(d.output(), ",")
+		}
+		fmt.Fprintf(d.output(), "I=%d", cmd.number)
+	}
+	if cmd.placement != 0 {
+		fmt.Fprintf(d.output(), ",p=%d", cmd.placement)
+	}
+	fmt.Fprintf(d.output(), ";%s\x1b\\", msg)
+}
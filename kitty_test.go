@@ -0,0 +1,95 @@
+package fansiterm
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func kittyAPC(control string, data []byte) []byte {
+	return []byte("\x1b_G" + control + ";" + base64.StdEncoding.EncodeToString(data) + "\x1b\\")
+}
+
+func TestKittyLimits(t *testing.T) {
+	d := New(10, 4, nil)
+	var out bytes.Buffer
+	d.Output = &out
+
+	// chunks that add up to more than the screen's worth of RGBA
+	chunk := make([]byte, 3000)
+	d.write(kittyAPC("a=t,i=1,f=32,s=80,v=64,m=1", chunk))
+	for range d.kittyMaxData()/len(chunk) + 1 {
+		d.write(kittyAPC("m=1", chunk))
+	}
+	d.write(kittyAPC("m=0", chunk))
+	if got, want := out.String(), "\x1b_Gi=1;EFBIG:image too large\x1b\\"; got != want {
+		t.Errorf("chunked: got %q, want %q", got, want)
+	}
+	if d.kitty.pending != nil || d.kitty.data != nil || d.kitty.discard {
+		t.Error("chunked transmission not dropped")
+	}
+
+	// a small compressed payload that inflates to far more than 4x4 pixels
+	out.Reset()
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(make([]byte, 1<<20))
+	zw.Close()
+	d.write(kittyAPC("a=t,i=2,f=32,s=4,v=4,o=z", z.Bytes()))
+	if got, want := out.String(), "\x1b_Gi=2;EFBIG:image too large\x1b\\"; got != want {
+		t.Errorf("compressed: got %q, want %q", got, want)
+	}
+
+	// a PNG claiming to be far bigger than the screen, sent in two chunks
+	out.Reset()
+	big := claimPNG(t, 8000, 8000)
+	d.write(kittyAPC("a=t,i=3,f=100,m=1", big[:len(big)/2]))
+	d.write(kittyAPC("m=0", big[len(big)/2:]))
+	if got, want := out.String(), "\x1b_Gi=3;EFBIG:image too large\x1b\\"; got != want {
+		t.Errorf("png: got %q, want %q", got, want)
+	}
+
+	// while one that fits is fine
+	out.Reset()
+	var small bytes.Buffer
+	png.Encode(&small, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	d.write(kittyAPC("a=t,i=4,f=100", small.Bytes()))
+	if got, want := out.String(), "\x1b_Gi=4;OK\x1b\\"; got != want {
+		t.Errorf("small png: got %q, want %q", got, want)
+	}
+}
+
+// claimPNG is a 1x1 PNG with its header changed to claim it's w by h.
+func claimPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// the signature, then IHDR's length and type, then its width and height
+	binary.BigEndian.PutUint32(data[16:], uint32(w))
+	binary.BigEndian.PutUint32(data[20:], uint32(h))
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestKittyDeleteFree(t *testing.T) {
+	d := New(10, 4, nil)
+	d.write(kittyAPC("a=t,i=1,f=32,s=1,v=1,q=2", make([]byte, 4)))
+	d.write([]byte("\x1b_Ga=p,i=1,p=1,q=2\x1b\\\x1b_Ga=p,i=1,p=2,q=2\x1b\\"))
+
+	d.write([]byte("\x1b_Ga=d,d=I,i=1,p=1,q=2\x1b\\"))
+	if _, ok := d.kitty.images[1]; !ok {
+		t.Fatal("image freed while a placement still shows it")
+	}
+	d.write([]byte("\x1b_Ga=d,d=I,i=1,p=2,q=2\x1b\\"))
+	if _, ok := d.kitty.images[1]; ok {
+		t.Error("image not freed after its last placement was deleted")
+	}
+}
@@ -0,0 +1,217 @@
+package fansiterm
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sparques/fansiterm/parser"
+)
+
+// kittykeys.go implements the kitty keyboard protocol
+// (https://sw.kovidgoyal.net/kitty/keyboard-protocol/). Programs turn on
+// progressive enhancements with CSI > flags u, which pushes the flags onto a
+// stack, and CSI < n u pops them again. While any are on, keys are sent as
+// CSI code ; modifiers u and similar sequences that can't be confused with
+// one another.
+
+// The progressive enhancement flags.
+const (
+	keyDisambiguate = 1 << iota
+	keyEventTypes
+	keyAlternates
+	keyAllAsEscapes
+	keyText
+)
+
+// keyFlagsMax is the depth of the stack of enhancement flags. Pushing onto a
+// full stack drops the oldest entry.
+const keyFlagsMax = 16
+
+// keyFlags returns the enhancement flags in effect.
+func (d *Device) keyFlags() int {
+	if len(d.keyFlagStack) == 0 {
+		return 0
+	}
+	return d.keyFlagStack[len(d.keyFlagStack)-1]
+}
+
+// handleKeyFlags handles CSI > flags u, CSI < n u, CSI = flags ; mode u and
+// CSI ? u, given the private marker and the parameters.
+func (d *Device) handleKeyFlags(marker byte, params *parser.Params) {
+	args := numericArgs(params, 0)
+	switch marker {
+	case '>': // push
+		if len(d.keyFlagStack) == keyFlagsMax {
+			d.keyFlagStack = d.keyFlagStack[1:]
+		}
+		d.keyFlagStack = append(d.keyFlagStack, args[0])
+	case '<': // pop
+		n := max(args[0], 1)
+		d.keyFlagStack = d.keyFlagStack[:len(d.keyFlagStack)-min(n, len(d.keyFlagStack))]
+	case '=': // set, or with mode 2 add to or mode 3 remove from, the current flags
+		if len(d.keyFlagStack) == 0 {
+			d.keyFlagStack = append(d.keyFlagStack, 0)
+		}
+		flags := &d.keyFlagStack[len(d.keyFlagStack)-1]
+		mode := 1
+		if len(args) > 1 {
+			mode = args[1]
+		}
+		switch mode {
+		case 1:
+			*flags = args[0]
+		case 2:
+			*flags |= args[0]
+		case 3:
+			*flags &^= args[0]
+		}
+	case '?': // query
+		d.output().Write([]byte("\x1b[?" + strconv.Itoa(d.keyFlags()) + "u"))
+	}
+}
+
+// kittyFunctionKeys are the kitty key numbers and final characters of the
+// keys that aren't sent as CSI number u.
+var kittyFunctionKeys = map[KeyCode]struct {
+	n     int
+	final byte
+}{
+	KeyUp: {1, 'A'}, KeyDown: {1, 'B'}, KeyRight: {1, 'C'}, KeyLeft: {1, 'D'},
+	KeyHome: {1, 'H'}, KeyEnd: {1, 'F'},
+	KeyInsert: {2, '~'}, KeyDelete: {3, '~'}, KeyPageUp: {5, '~'}, KeyPageDown: {6, '~'},
+	KeyF1: {1, 'P'}, KeyF2: {1, 'Q'}, KeyF3: {13, '~'}, KeyF4: {1, 'S'},
+	KeyF5: {15, '~'}, KeyF6: {17, '~'}, KeyF7: {18, '~'}, KeyF8: {19, '~'},
+	KeyF9: {20, '~'}, KeyF10: {21, '~'}, KeyF11: {23, '~'}, KeyF12: {24, '~'},
+}
+
+// encodeKittyKey encodes k according to the enhancement flags.
+func (d *Device) encodeKittyKey(k Key, flags int) []byte {
+	if k.Event != KeyPress && flags&keyEventTypes == 0 {
+		if k.Event == KeyRelease {
+			return nil
+		}
+		k.Event = KeyPress
+	}
+
+	// The keypad only has numbers of its own when every key is to be sent
+	// as an escape code; otherwise it types the same characters as the main
+	// keyboard does.
+	if flags&keyAllAsEscapes == 0 && k.Code >= KeyKP0 && k.Code <= KeyKPSeparator {
+		switch {
+		case k.Code <= KeyKP9:
+			k.Code, k.Rune = KeyRune, '0'+rune(k.Code-KeyKP0)
+		case k.Code == KeyKPEnter:
+			k.Code = KeyEnter
+		default:
+			k.Code, k.Rune = KeyRune, rune(keypadKeys[k.Code][0])
+		}
+	}
+
+	code, final := 0, byte('u')
+	switch {
+	case k.Code == KeyRune:
+		base := k.Base
+		if base == 0 {
+			base, _ = utf8.DecodeRuneInString(strings.ToLower(string(k.Rune)))
+		}
+		code = int(base)
+	case k.Code == KeyEnter:
+		code = '\r'
+	case k.Code == KeyTab:
+		code = '\t'
+	case k.Code == KeyBackspace:
+		code = 0x7f
+	case k.Code == KeyEscape:
+		code = 0x1b
+	case k.Code >= KeyF13 && k.Code <= KeyF24:
+		code = 57376 + int(k.Code-KeyF13)
+	case k.Code >= KeyKP0 && k.Code <= KeyKPSeparator:
+		code = 57399 + int(k.Code-KeyKP0)
+	default:
+		key, ok := kittyFunctionKeys[k.Code]
+		if !ok {
+			return nil
+		}
+		code, final = key.n, key.final
+	}
+
+	// Unless every key is to be sent as an escape code, keys that type
+	// something, or Enter, Tab and Backspace, are sent as they are without
+	// the protocol. Shift and the lock keys don't count, as they are already
+	// part of the character.
+	mod := k.Mod &^ (ModCapsLock | ModNumLock)
+	if flags&keyAllAsEscapes == 0 {
+		switch k.Code {
+		case KeyRune:
+			if k.Event != KeyRelease && (mod&^ModShift == 0 || flags&keyDisambiguate == 0) {
+				k.Mod = mod
+				return d.encodeOtherKey(k)
+			}
+		case KeyEnter, KeyTab, KeyBackspace:
+			if k.Event == KeyRelease {
+				return nil
+			}
+			if mod == 0 || flags&keyDisambiguate == 0 {
+				k.Mod = mod
+				return d.encodeOtherKey(k)
+			}
+		case KeyEscape:
+			if flags&keyDisambiguate == 0 && k.Event != KeyRelease {
+				k.Mod = mod
+				return d.encodeOtherKey(k)
+			}
+		}
+	}
+
+	seq := []byte("\x1b[")
+	var params []byte
+
+	// alternate keys: the shifted key and the key in the base layout
+	if flags&keyAlternates != 0 && k.Code == KeyRune {
+		var shifted, layout rune
+		if k.Mod&ModShift != 0 && int(k.Rune) != code {
+			shifted = k.Rune
+		}
+		if k.Layout != 0 && int(k.Layout) != code {
+			layout = k.Layout
+		}
+		if shifted != 0 || layout != 0 {
+			params = append(params, ':')
+			if shifted != 0 {
+				params = strconv.AppendInt(params, int64(shifted), 10)
+			}
+			if layout != 0 {
+				params = append(params, ':')
+				params = strconv.AppendInt(params, int64(layout), 10)
+			}
+		}
+	}
+
+	// the text the key types, if asked for
+	var text []byte
+	if flags&keyText != 0 && flags&keyAllAsEscapes != 0 && k.Code == KeyRune &&
+		k.Event != KeyRelease && k.Mod&(ModCtrl|ModAlt|ModMeta) == 0 && strconv.IsPrint(k.Rune) {
+		text = strconv.AppendInt(text, int64(k.Rune), 10)
+	}
+
+	if k.Mod != 0 || k.Event != KeyPress || len(text) > 0 {
+		params = append(params, ';')
+		params = strconv.AppendInt(params, int64(modParam(k.Mod)), 10)
+		if k.Event != KeyPress {
+			params = append(params, ':')
+			params = strconv.AppendInt(params, int64(k.Event+1), 10)
+		}
+	}
+	if len(text) > 0 {
+		params = append(params, ';')
+		params = append(params, text...)
+	}
+
+	// the key number 1 can be left out if nothing follows it
+	if code != 1 || len(params) > 0 {
+		seq = strconv.AppendInt(seq, int64(code), 10)
+	}
+	seq = append(seq, params...)
+	return append(seq, final)
+}
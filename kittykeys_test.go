@@ -0,0 +1,48 @@
+package fansiterm
+
+import "testing"
+
+func TestEncodeKittyKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags string
+		key   Key
+		want  string
+	}{
+		{"text", "1", Key{Rune: 'a'}, "a"},
+		{"ctrl", "1", Key{Rune: 'a', Mod: ModCtrl}, "\x1b[97;5u"},
+		{"escape", "1", Key{Code: KeyEscape}, "\x1b[27u"},
+		{"enter", "1", Key{Code: KeyEnter}, "\r"},
+		{"keypad digit", "1", Key{Code: KeyKP5}, "5"},
+		{"keypad operator", "1", Key{Code: KeyKPAdd}, "+"},
+		{"keypad enter", "1", Key{Code: KeyKPEnter}, "\r"},
+		{"keypad all as escapes", "8", Key{Code: KeyKP5}, "\x1b[57404u"},
+		{"cursor", "1", Key{Code: KeyUp}, "\x1b[A"},
+		{"release ignored", "1", Key{Rune: 'a', Event: KeyRelease}, ""},
+		{"release", "10", Key{Rune: 'a', Event: KeyRelease}, "\x1b[97;1:3u"},
+		{"shifted alternate", "12", Key{Rune: 'A', Mod: ModShift}, "\x1b[97:65;2u"},
+		{"text as codepoints", "24", Key{Rune: 'a'}, "\x1b[97;1;97u"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(10, 4, nil)
+			d.write([]byte("\x1b[>" + tt.flags + "u"))
+			if got := string(d.EncodeKey(tt.key)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyFlagsAltScreen(t *testing.T) {
+	d := New(10, 4, nil)
+	d.Config.AltScreen = true
+	d.write([]byte("\x1b[>1u\x1b[?1049h"))
+	if got := d.keyFlags(); got != 0 {
+		t.Errorf("alternate screen starts with flags %d, want 0", got)
+	}
+	d.write([]byte("\x1b[>3u\x1b[?1049l"))
+	if got := d.keyFlags(); got != 1 {
+		t.Errorf("main screen flags %d after leaving the alternate screen, want 1", got)
+	}
+}
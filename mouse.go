@@ -0,0 +1,169 @@
+package fansiterm
+
+import (
+	"image"
+	"strconv"
+	"unicode/utf8"
+)
+
+// mouse.go reports mouse (or touchscreen) events to the host, in whichever
+// of the xterm tracking modes and encodings it has asked for. Events are
+// given in pixels, as a touch controller reports them, and converted to
+// cells here.
+
+// MouseButton is the button of a mouse event.
+type MouseButton int
+
+const (
+	MouseLeft MouseButton = iota
+	MouseMiddle
+	MouseRight
+	// MouseNone is for motion with no button held.
+	MouseNone
+	MouseWheelUp
+	MouseWheelDown
+	MouseWheelLeft
+	MouseWheelRight
+	// MouseBack and MouseForward are buttons 8 and 9.
+	MouseBack
+	MouseForward
+)
+
+// MouseAction is what happened in a mouse event.
+type MouseAction int
+
+const (
+	MousePress MouseAction = iota
+	MouseRelease
+	MouseMotion
+)
+
+// Mouse is a mouse event.
+type Mouse struct {
+	// X and Y are in pixels, in the coordinates of Render.Image.
+	X, Y   int
+	Button MouseButton
+	Action MouseAction
+	// Mod can have ModShift, ModAlt (or ModMeta) and ModCtrl.
+	Mod Modifier
+}
+
+// mouseState is what's remembered between mouse events.
+type mouseState struct {
+	// last is the cell of the last motion reported, if moved is set, so
+	// that motion within a cell is only reported once.
+	last  image.Point
+	moved bool
+}
+
+// SendMouse reports ev to the host through Output, if the current mouse
+// tracking mode calls for it.
+func (d *Device) SendMouse(ev Mouse) error {
+	d.Lock()
+	defer d.Unlock()
+	seq := d.encodeMouse(ev)
+	if len(seq) == 0 {
+		return nil
+	}
+	_, err := d.Output.Write(seq)
+	return err
+}
+
+// mouseButtonCode is the button part of the xterm button code.
+var mouseButtonCode = map[MouseButton]int{
+	MouseLeft: 0, MouseMiddle: 1, MouseRight: 2, MouseNone: 3,
+	MouseWheelUp: 64, MouseWheelDown: 65, MouseWheelLeft: 66, MouseWheelRight: 67,
+	MouseBack: 128, MouseForward: 129,
+}
+
+func (d *Device) encodeMouse(ev Mouse) []byte {
+	mode := d.Config.MouseEvents
+	wheel := ev.Button >= MouseWheelUp && ev.Button <= MouseWheelRight
+	switch {
+	case mode != 9 && mode != 1000 && mode != 1002 && mode != 1003:
+		return nil
+	case mode == 9 && (ev.Action != MousePress || wheel):
+		// X10 compatibility mode only reports presses, and not of the wheel
+		return nil
+	case wheel && ev.Action != MousePress:
+		// wheel "buttons" are never released
+		return nil
+	case ev.Action == MouseMotion && mode < 1002:
+		return nil
+	case ev.Action == MouseMotion && mode == 1002 && ev.Button == MouseNone:
+		// button event tracking only reports motion while a button is held
+		return nil
+	}
+
+	pt := image.Pt(ev.X, ev.Y).Sub(d.Render.bounds.Min)
+	if ev.Action == MousePress && !pt.In(d.Render.bounds.Sub(d.Render.bounds.Min)) {
+		return nil
+	}
+	// drags and releases outside the text area are clamped to its edge
+	pt.X = bound(pt.X, 0, d.Render.bounds.Dx()-1)
+	pt.Y = bound(pt.Y, 0, d.Render.bounds.Dy()-1)
+	cell := image.Pt(
+		bound(pt.X/d.Render.cell.Dx(), 0, d.cols-1),
+		bound(pt.Y/d.Render.cell.Dy(), 0, d.rows-1))
+
+	if ev.Action == MouseMotion {
+		if d.mouse.moved && cell == d.mouse.last && !d.Config.MouseSGRPixels {
+			return nil
+		}
+		d.mouse.last, d.mouse.moved = cell, true
+	} else {
+		d.mouse.moved = false
+	}
+
+	sgr := d.Config.MouseSGR || d.Config.MouseSGRPixels
+	cb := mouseButtonCode[ev.Button]
+	if ev.Action == MouseRelease && !sgr {
+		// only SGR says which button was released
+		cb = 3
+	}
+	if ev.Action == MouseMotion {
+		cb += 32
+	}
+	if mode != 9 {
+		if ev.Mod&ModShift != 0 {
+			cb += 4
+		}
+		if ev.Mod&(ModAlt|ModMeta) != 0 {
+			cb += 8
+		}
+		if ev.Mod&ModCtrl != 0 {
+			cb += 16
+		}
+	}
+
+	// coordinates are 1-based
+	x, y := cell.X+1, cell.Y+1
+	switch {
+	case d.Config.MouseSGRPixels:
+		x, y = pt.X+1, pt.Y+1
+		fallthrough
+	case d.Config.MouseSGR:
+		final := byte('M')
+		if ev.Action == MouseRelease {
+			final = 'm'
+		}
+		return []byte("\x1b[<" + strconv.Itoa(cb) + ";" + strconv.Itoa(x) + ";" + strconv.Itoa(y) + string(final))
+	case d.Config.MouseURXVT:
+		return []byte("\x1b[" + strconv.Itoa(cb+32) + ";" + strconv.Itoa(x) + ";" + strconv.Itoa(y) + "M")
+	case d.Config.MouseUTF8:
+		seq := []byte("\x1b[M")
+		for _, v := range []int{cb, x, y} {
+			if v+32 > 2047 {
+				return nil
+			}
+			seq = utf8.AppendRune(seq, rune(v+32))
+		}
+		return seq
+	default:
+		// each value is a single byte, so positions past 223 can't be sent
+		if cb+32 > 255 || x+32 > 255 || y+32 > 255 {
+			return nil
+		}
+		return []byte{0x1b, '[', 'M', byte(cb + 32), byte(x + 32), byte(y + 32)}
+	}
+}
@@ -0,0 +1,124 @@
+package fansiterm
+
+import (
+	"fmt"
+	"testing"
+)
+
+// cellEvent is a mouse event in the middle of the cell at col, row.
+func cellEvent(d *Device, col, row int, button MouseButton, action MouseAction, mod Modifier) Mouse {
+	cw, ch := d.Render.cell.Dx(), d.Render.cell.Dy()
+	return Mouse{X: col*cw + cw/2, Y: row*ch + ch/2, Button: button, Action: action, Mod: mod}
+}
+
+func TestEncodeMouseModes(t *testing.T) {
+	encodings := []struct {
+		name  string
+		setup string
+		want  func(d *Device, ev Mouse, cb int) string
+	}{
+		{"default", "", func(d *Device, ev Mouse, cb int) string {
+			return string([]byte{0x1b, '[', 'M', byte(cb + 32), 3 + 32, 2 + 32})
+		}},
+		{"utf8", "\x1b[?1005h", func(d *Device, ev Mouse, cb int) string {
+			return string([]byte{0x1b, '[', 'M', byte(cb + 32), 3 + 32, 2 + 32})
+		}},
+		{"sgr", "\x1b[?1006h", func(d *Device, ev Mouse, cb int) string {
+			return fmt.Sprintf("\x1b[<%d;3;2M", cb)
+		}},
+		{"urxvt", "\x1b[?1015h", func(d *Device, ev Mouse, cb int) string {
+			return fmt.Sprintf("\x1b[%d;3;2M", cb+32)
+		}},
+		{"sgr pixels", "\x1b[?1016h", func(d *Device, ev Mouse, cb int) string {
+			return fmt.Sprintf("\x1b[<%d;%d;%dM", cb, ev.X+1, ev.Y+1)
+		}},
+	}
+	modes := []struct {
+		mode int
+		// cb is the button code of a shifted left click
+		cb int
+	}{
+		{9, 0}, // X10 doesn't report modifiers
+		{1000, 4},
+		{1002, 4},
+		{1003, 4},
+	}
+	for _, enc := range encodings {
+		for _, m := range modes {
+			t.Run(fmt.Sprintf("%s/%d", enc.name, m.mode), func(t *testing.T) {
+				d := New(20, 4, nil)
+				d.write([]byte(fmt.Sprintf("\x1b[?%dh", m.mode) + enc.setup))
+				ev := cellEvent(d, 2, 1, MouseLeft, MousePress, ModShift)
+				if got, want := string(d.encodeMouse(ev)), enc.want(d, ev, m.cb); got != want {
+					t.Errorf("got %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestEncodeMouseEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  string
+		button MouseButton
+		action MouseAction
+		want   string
+	}{
+		{"x10 release", "\x1b[?9h", MouseLeft, MouseRelease, ""},
+		{"x10 wheel", "\x1b[?9h", MouseWheelUp, MousePress, ""},
+		{"x10 motion", "\x1b[?9h", MouseLeft, MouseMotion, ""},
+		{"release", "\x1b[?1000h", MouseLeft, MouseRelease, "\x1b[M##\""},
+		{"sgr release", "\x1b[?1000h\x1b[?1006h", MouseRight, MouseRelease, "\x1b[<2;3;2m"},
+		{"wheel", "\x1b[?1000h", MouseWheelUp, MousePress, "\x1b[M`#\""},
+		{"wheel release", "\x1b[?1000h", MouseWheelUp, MouseRelease, ""},
+		{"normal drag", "\x1b[?1000h", MouseLeft, MouseMotion, ""},
+		{"button drag", "\x1b[?1002h", MouseLeft, MouseMotion, "\x1b[M@#\""},
+		{"button motion", "\x1b[?1002h", MouseNone, MouseMotion, ""},
+		{"any drag", "\x1b[?1003h", MouseLeft, MouseMotion, "\x1b[M@#\""},
+		{"any motion", "\x1b[?1003h", MouseNone, MouseMotion, "\x1b[MC#\""},
+		{"off", "", MouseLeft, MousePress, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(20, 4, nil)
+			d.write([]byte(tt.setup))
+			ev := cellEvent(d, 2, 1, tt.button, tt.action, 0)
+			if got := string(d.encodeMouse(ev)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeMouseBounds(t *testing.T) {
+	d := New(300, 4, nil)
+	d.write([]byte("\x1b[?1002h"))
+	cw := d.Render.cell.Dx()
+
+	// presses outside the screen aren't reported, drags are clamped
+	outside := Mouse{X: 300*cw + 5, Y: 1, Button: MouseLeft, Action: MousePress}
+	if got := d.encodeMouse(outside); got != nil {
+		t.Errorf("press outside the screen: got %q", got)
+	}
+	d.write([]byte("\x1b[?1006h"))
+	outside.Action = MouseMotion
+	if got, want := string(d.encodeMouse(outside)), "\x1b[<32;300;1M"; got != want {
+		t.Errorf("drag outside the screen: got %q, want %q", got, want)
+	}
+	d.write([]byte("\x1b[?1006l"))
+
+	// the default encoding can't go past column 223
+	if got, want := string(d.encodeMouse(cellEvent(d, 222, 0, MouseLeft, MousePress, 0))), "\x1b[M \xff!"; got != want {
+		t.Errorf("column 223: got %q, want %q", got, want)
+	}
+	if got := d.encodeMouse(cellEvent(d, 223, 0, MouseLeft, MousePress, 0)); got != nil {
+		t.Errorf("column 224: got %q, want nothing", got)
+	}
+
+	// but UTF-8 can
+	d.write([]byte("\x1b[?1005h"))
+	if got, want := string(d.encodeMouse(cellEvent(d, 223, 0, MouseLeft, MousePress, 0))), "\x1b[M Ā!"; got != want {
+		t.Errorf("utf8 column 224: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+package parser
+
+// MaxParams is the most values, counting subparameters, that a control
+// sequence can carry. A sequence with more is ignored.
+const MaxParams = 32
+
+// maxParamValue is where parameter values saturate.
+const maxParamValue = 65535
+
+// Params holds the numeric parameters of a CSI or DCS sequence. Parameters are
+// separated by ';', and each may be split into subparameters with ':', as in
+// CSI 38:2::255:0:0 m. An omitted value is -1.
+//
+// The slices Params returns point into the Parser and are only valid until
+// the handler returns.
+type Params struct {
+	vals [MaxParams]int
+	// sub has bit i set if vals[i] is a subparameter of the value before it
+	sub uint32
+	n   int
+}
+
+func (p *Params) reset() {
+	p.n, p.sub = 0, 0
+}
+
+// start makes sure there is a current value to add digits to.
+func (p *Params) start() bool {
+	if p.n == 0 {
+		return p.next(false)
+	}
+	return true
+}
+
+// next starts a new value, a subparameter of the last one if sub is set. It
+// reports false if there is no room for it.
+func (p *Params) next(sub bool) bool {
+	if p.n == MaxParams {
+		return false
+	}
+	p.vals[p.n] = -1
+	if sub {
+		p.sub |= 1 << p.n
+	}
+	p.n++
+	return true
+}
+
+func (p *Params) digit(b byte) {
+	v := &p.vals[p.n-1]
+	*v = min(max(*v, 0)*10+int(b-'0'), maxParamValue)
+}
+
+// Len is the number of parameters, not counting subparameters.
+func (p *Params) Len() int {
+	n := 0
+	for i := range p.n {
+		if p.sub&(1<<i) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Get returns parameter i, or def if it was omitted or there aren't that
+// many.
+func (p *Params) Get(i, def int) int {
+	if sub := p.Sub(i); len(sub) > 0 && sub[0] >= 0 {
+		return sub[0]
+	}
+	return def
+}
+
+// Sub returns parameter i followed by its subparameters, or nil if there
+// aren't that many parameters.
+func (p *Params) Sub(i int) []int {
+	for j := range p.n {
+		if p.sub&(1<<j) != 0 {
+			continue
+		}
+		if i > 0 {
+			i--
+			continue
+		}
+		end := j + 1
+		for end < p.n && p.sub&(1<<end) != 0 {
+			end++
+		}
+		return p.vals[j:end]
+	}
+	return nil
+}
@@ -0,0 +1,459 @@
+/*
+Package parser implements the state machine that DEC VT500-series terminals
+use to split their input into text, control characters and escape sequences,
+as described by Paul Williams at https://vt100.net/emu/dec_ansi_parser.
+
+A Parser is fed bytes, or runes already decoded by the caller, and calls a
+Handler for each complete action: a character to print, a control character
+to execute, or an ESC, CSI, OSC, APC or DCS sequence with its intermediates
+and parameters. It doesn't know what any sequence means, so it can be used by
+a terminal or by host-side tools that need to pick apart terminal output.
+
+Parameters and intermediates are kept in fixed-size buffers in the Parser,
+and OSC and APC strings in a buffer that is reused once it has grown to fit
+them, so parsing doesn't allocate in the long run. They are handed to the
+Handler as slices of those buffers, which are only valid until the Handler
+returns.
+
+Compared with the original DEC parser:
+  - Input is UTF-8 unless EightBit is set. The C1 controls are then the code
+    points U+0080-U+009F rather than single bytes.
+  - Parameters may have ':' separated subparameters.
+  - APC strings are passed to the Handler; SOS and PM strings are ignored.
+  - BEL ends an OSC or APC string as well as ST, as with xterm.
+  - CAN and SUB discard an unfinished OSC or APC string instead of
+    dispatching it, and an unfinished DCS isn't unhooked. The Handler is
+    told with Abort, then gets Execute with the CAN or SUB.
+*/
+package parser // github.com/sparques/fansiterm/parser
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+var (
+	// ErrCancelled is passed to Handler.Abort when CAN or SUB cancels a
+	// sequence.
+	ErrCancelled = errors.New("parser: sequence cancelled")
+	// ErrTooLong is passed to Handler.Abort when an OSC or APC string longer
+	// than MaxString ends.
+	ErrTooLong = errors.New("parser: string too long")
+)
+
+// MaxIntermediates is the most intermediate characters, private markers
+// included, a sequence can have. A sequence with more is ignored.
+const MaxIntermediates = 2
+
+// Handler receives the actions of a Parser.
+type Handler interface {
+	// Print draws a character.
+	Print(r rune)
+	// Execute acts on a C0 or C1 control character.
+	Execute(b byte)
+	// ESC dispatches an escape sequence, e.g. ESC ( B has final 'B' and
+	// intermediates "(".
+	ESC(final byte, intermediates []byte)
+	// CSI dispatches a control sequence. Private markers such as the '?' of
+	// CSI ? 25 h are included in intermediates.
+	CSI(final byte, params *Params, intermediates []byte)
+	// OSC dispatches an operating system command, e.g. "0;title".
+	OSC(data []byte)
+	// APC dispatches an application program command, e.g. the kitty
+	// graphics protocol's "Ga=T;...".
+	APC(data []byte)
+	// DCSHook starts a device control string. The data that follows is
+	// passed to DCSPut a byte at a time, then DCSUnhook is called.
+	DCSHook(final byte, params *Params, intermediates []byte)
+	DCSPut(b byte)
+	DCSUnhook()
+	// Abort reports a sequence that was dropped rather than dispatched, with
+	// ErrCancelled or ErrTooLong. An unfinished DCS gets Abort instead of
+	// DCSUnhook.
+	Abort(err error)
+}
+
+type state uint8
+
+const (
+	stateGround state = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSIEntry
+	stateCSIParam
+	stateCSIIntermediate
+	stateCSIIgnore
+	stateDCSEntry
+	stateDCSParam
+	stateDCSIntermediate
+	stateDCSPassthrough
+	stateDCSIgnore
+	stateOSCString
+	stateAPCString
+	stateSOSPMString
+)
+
+// Parser is a VT500-series input parser. The zero value is ready to use.
+type Parser struct {
+	// EightBit makes every byte a character of its own, as on the original
+	// terminals: 0x80-0x9F are C1 controls and 0xA0-0xFF print as Latin-1.
+	// Otherwise input is UTF-8.
+	EightBit bool
+	// MaxString is the longest OSC or APC string, in bytes, passed to the
+	// Handler. A longer one is dropped, up to its terminator. Zero means no
+	// limit.
+	MaxString int
+
+	state  state
+	params Params
+	inter  [MaxIntermediates]byte
+	nInter int
+	// overflow is set when a sequence has too many parameters or
+	// intermediates to keep; it is then ignored rather than dispatched.
+	overflow bool
+
+	// str collects an OSC or APC string. strDrop is set when it's too long.
+	str     []byte
+	strDrop bool
+
+	// utf8 holds a partial UTF-8 character.
+	utf8    [utf8.UTFMax]byte
+	utf8Len int
+}
+
+// Reset returns p to the ground state, dropping any unfinished sequence.
+func (p *Parser) Reset() {
+	p.state = stateGround
+	p.utf8Len = 0
+}
+
+// Ground reports whether p is between sequences, with nothing unfinished.
+func (p *Parser) Ground() bool {
+	return p.state == stateGround && p.utf8Len == 0
+}
+
+// Parse runs data through the parser, calling h for each action. Sequences
+// and characters may be split across calls.
+func (p *Parser) Parse(h Handler, data []byte) {
+	for _, b := range data {
+		p.Advance(h, b)
+	}
+}
+
+// Advance runs a single byte through the parser.
+func (p *Parser) Advance(h Handler, b byte) {
+	if !p.EightBit && (b >= 0x80 || p.utf8Len > 0) {
+		p.advanceUTF8(h, b)
+		return
+	}
+	p.advance(h, b)
+}
+
+// AdvanceRune runs a character through the parser, for callers that decode
+// their input themselves. EightBit doesn't apply; the C1 controls are
+// U+0080-U+009F.
+func (p *Parser) AdvanceRune(h Handler, r rune) {
+	if r < 0x80 {
+		p.advance(h, byte(r))
+		return
+	}
+	var raw [utf8.UTFMax]byte
+	p.char(h, r, utf8.AppendRune(raw[:0], r))
+}
+
+// advanceUTF8 collects the bytes of a UTF-8 character. A byte that can't
+// continue the character ends it; an invalid character is U+FFFD.
+func (p *Parser) advanceUTF8(h Handler, b byte) {
+	if p.utf8Len > 0 && b&0xC0 != 0x80 {
+		p.utf8Len = 0
+		p.char(h, utf8.RuneError, nil)
+		p.Advance(h, b)
+		return
+	}
+	p.utf8[p.utf8Len] = b
+	p.utf8Len++
+	if !utf8.FullRune(p.utf8[:p.utf8Len]) {
+		return
+	}
+	r, _ := utf8.DecodeRune(p.utf8[:p.utf8Len])
+	n := p.utf8Len
+	p.utf8Len = 0
+	p.char(h, r, p.utf8[:n])
+}
+
+// char handles a decoded non-ASCII character whose encoding was raw.
+func (p *Parser) char(h Handler, r rune, raw []byte) {
+	if r >= 0x80 && r <= 0x9F {
+		p.advance(h, byte(r))
+		return
+	}
+	switch p.state {
+	case stateGround:
+		h.Print(r)
+	case stateOSCString, stateAPCString:
+		for _, b := range raw {
+			p.strPut(b)
+		}
+	case stateDCSPassthrough:
+		for _, b := range raw {
+			h.DCSPut(b)
+		}
+	}
+}
+
+// advance is the state machine proper.
+func (p *Parser) advance(h Handler, b byte) {
+	// transitions from anywhere
+	switch {
+	case b == 0x18 || b == 0x1A: // CAN, SUB
+		// an unfinished sequence is dropped, without dispatching it
+		if p.state != stateGround {
+			p.state = stateGround
+			h.Abort(ErrCancelled)
+		}
+		h.Execute(b)
+		return
+	case b == 0x1B:
+		p.transition(h, stateEscape)
+		return
+	case b >= 0x80 && b <= 0x9F:
+		p.c1(h, b)
+		return
+	}
+
+	// GR is treated like GL, apart from printing
+	c := b &^ 0x80
+
+	switch p.state {
+	case stateGround:
+		if c < 0x20 {
+			h.Execute(b)
+		} else {
+			h.Print(rune(b))
+		}
+
+	case stateEscape:
+		switch {
+		case c < 0x20:
+			h.Execute(b)
+		case c <= 0x2F:
+			p.collect(b)
+			p.state = stateEscapeIntermediate
+		case c == '[':
+			p.transition(h, stateCSIEntry)
+		case c == ']':
+			p.transition(h, stateOSCString)
+		case c == 'P':
+			p.transition(h, stateDCSEntry)
+		case c == '_':
+			p.transition(h, stateAPCString)
+		case c == 'X' || c == '^':
+			p.transition(h, stateSOSPMString)
+		case c < 0x7F:
+			p.escDispatch(h, b)
+		}
+
+	case stateEscapeIntermediate:
+		switch {
+		case c < 0x20:
+			h.Execute(b)
+		case c <= 0x2F:
+			p.collect(b)
+		case c < 0x7F:
+			p.escDispatch(h, b)
+		}
+
+	case stateCSIEntry, stateCSIParam:
+		switch {
+		case c < 0x20:
+			h.Execute(b)
+		case c <= 0x2F:
+			p.collect(b)
+			p.state = stateCSIIntermediate
+		case c <= 0x3B:
+			p.param(b, stateCSIParam, stateCSIIgnore)
+		case c <= 0x3F && p.state == stateCSIEntry:
+			p.collect(b)
+			p.state = stateCSIParam
+		case c <= 0x3F:
+			p.state = stateCSIIgnore
+		case c < 0x7F:
+			p.csiDispatch(h, b)
+		}
+
+	case stateCSIIntermediate:
+		switch {
+		case c < 0x20:
+			h.Execute(b)
+		case c <= 0x2F:
+			p.collect(b)
+		case c <= 0x3F:
+			p.state = stateCSIIgnore
+		case c < 0x7F:
+			p.csiDispatch(h, b)
+		}
+
+	case stateCSIIgnore:
+		switch {
+		case c < 0x20:
+			h.Execute(b)
+		case c >= 0x40 && c < 0x7F:
+			p.state = stateGround
+		}
+
+	case stateDCSEntry, stateDCSParam:
+		switch {
+		case c < 0x20:
+		case c <= 0x2F:
+			p.collect(b)
+			p.state = stateDCSIntermediate
+		case c <= 0x3B:
+			p.param(b, stateDCSParam, stateDCSIgnore)
+		case c <= 0x3F && p.state == stateDCSEntry:
+			p.collect(b)
+			p.state = stateDCSParam
+		case c <= 0x3F:
+			p.state = stateDCSIgnore
+		case c < 0x7F:
+			p.hook(h, b)
+		}
+
+	case stateDCSIntermediate:
+		switch {
+		case c < 0x20:
+		case c <= 0x2F:
+			p.collect(b)
+		case c <= 0x3F:
+			p.state = stateDCSIgnore
+		case c < 0x7F:
+			p.hook(h, b)
+		}
+
+	case stateDCSPassthrough:
+		if c != 0x7F {
+			h.DCSPut(b)
+		}
+
+	case stateOSCString, stateAPCString:
+		switch {
+		case b == '\a':
+			p.transition(h, stateGround)
+		case c >= 0x20:
+			p.strPut(b)
+		}
+
+	case stateDCSIgnore, stateSOSPMString:
+		// ignored until ST
+	}
+}
+
+// c1 handles an 8-bit control character.
+func (p *Parser) c1(h Handler, b byte) {
+	switch b {
+	case 0x90: // DCS
+		p.transition(h, stateDCSEntry)
+	case 0x9B: // CSI
+		p.transition(h, stateCSIEntry)
+	case 0x9C: // ST
+		p.transition(h, stateGround)
+	case 0x9D: // OSC
+		p.transition(h, stateOSCString)
+	case 0x9F: // APC
+		p.transition(h, stateAPCString)
+	case 0x98, 0x9E: // SOS, PM
+		p.transition(h, stateSOSPMString)
+	default:
+		p.transition(h, stateGround)
+		h.Execute(b)
+	}
+}
+
+// transition moves to another state, performing the exit action of the
+// current state and the entry action of the next.
+func (p *Parser) transition(h Handler, next state) {
+	switch {
+	case (p.state == stateOSCString || p.state == stateAPCString) && p.strDrop:
+		h.Abort(ErrTooLong)
+	case p.state == stateOSCString:
+		h.OSC(p.str)
+	case p.state == stateAPCString:
+		h.APC(p.str)
+	case p.state == stateDCSPassthrough:
+		h.DCSUnhook()
+	}
+	p.state = next
+	switch next {
+	case stateEscape, stateCSIEntry, stateDCSEntry:
+		p.clear()
+	case stateOSCString, stateAPCString:
+		p.str = p.str[:0]
+		p.strDrop = false
+	}
+}
+
+func (p *Parser) clear() {
+	p.params.reset()
+	p.nInter = 0
+	p.overflow = false
+}
+
+func (p *Parser) collect(b byte) {
+	if p.nInter == MaxIntermediates {
+		p.overflow = true
+		return
+	}
+	p.inter[p.nInter] = b
+	p.nInter++
+}
+
+// param adds a digit or separator to the parameters, then moves to the next
+// state, or to ignore if there are too many.
+func (p *Parser) param(b byte, next, ignore state) {
+	ok := p.params.start()
+	switch b {
+	case ';':
+		ok = ok && p.params.next(false)
+	case ':':
+		ok = ok && p.params.next(true)
+	default:
+		p.params.digit(b)
+	}
+	if !ok {
+		p.overflow = true
+		next = ignore
+	}
+	p.state = next
+}
+
+func (p *Parser) escDispatch(h Handler, final byte) {
+	p.state = stateGround
+	if !p.overflow {
+		h.ESC(final, p.inter[:p.nInter])
+	}
+}
+
+func (p *Parser) csiDispatch(h Handler, final byte) {
+	p.state = stateGround
+	if !p.overflow {
+		h.CSI(final, &p.params, p.inter[:p.nInter])
+	}
+}
+
+func (p *Parser) hook(h Handler, final byte) {
+	if p.overflow {
+		p.state = stateDCSIgnore
+		return
+	}
+	p.state = stateDCSPassthrough
+	h.DCSHook(final, &p.params, p.inter[:p.nInter])
+}
+
+func (p *Parser) strPut(b byte) {
+	switch {
+	case p.strDrop:
+	case p.MaxString > 0 && len(p.str) >= p.MaxString:
+		p.strDrop = true
+	default:
+		p.str = append(p.str, b)
+	}
+}
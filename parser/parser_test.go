@@ -0,0 +1,200 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// recorder logs every action as a line of text.
+type recorder struct {
+	log []string
+}
+
+func (r *recorder) Print(c rune)   { r.log = append(r.log, fmt.Sprintf("print %q", c)) }
+func (r *recorder) Execute(b byte) { r.log = append(r.log, fmt.Sprintf("exec %#x", b)) }
+
+func (r *recorder) ESC(final byte, inter []byte) {
+	r.log = append(r.log, fmt.Sprintf("esc %q %c", inter, final))
+}
+
+func (r *recorder) CSI(final byte, params *Params, inter []byte) {
+	r.log = append(r.log, fmt.Sprintf("csi %q %s %c", inter, formatParams(params), final))
+}
+
+func (r *recorder) OSC(data []byte) { r.log = append(r.log, fmt.Sprintf("osc %q", data)) }
+func (r *recorder) APC(data []byte) { r.log = append(r.log, fmt.Sprintf("apc %q", data)) }
+
+func (r *recorder) DCSHook(final byte, params *Params, inter []byte) {
+	r.log = append(r.log, fmt.Sprintf("hook %q %s %c", inter, formatParams(params), final))
+}
+
+func (r *recorder) DCSPut(b byte)   { r.log = append(r.log, fmt.Sprintf("put %q", b)) }
+func (r *recorder) DCSUnhook()      { r.log = append(r.log, "unhook") }
+func (r *recorder) Abort(err error) { r.log = append(r.log, fmt.Sprintf("abort %v", err)) }
+
+func formatParams(p *Params) string {
+	var groups []string
+	for i := range p.Len() {
+		var vals []string
+		for _, v := range p.Sub(i) {
+			vals = append(vals, fmt.Sprint(v))
+		}
+		groups = append(groups, strings.Join(vals, ":"))
+	}
+	return "[" + strings.Join(groups, ";") + "]"
+}
+
+func TestParser(t *testing.T) {
+	tests := []struct {
+		name     string
+		eightBit bool
+		input    string
+		want     []string
+	}{
+		{"text", false, "hi\n", []string{`print 'h'`, `print 'i'`, `exec 0xa`}},
+		{"utf8", false, "é😀", []string{`print 'é'`, `print '😀'`}},
+		{"invalid utf8", false, "\xc3(", []string{`print '�'`, `print '('`}},
+		{"esc", false, "\x1b(B\x1b7", []string{`esc "(" B`, `esc "" 7`}},
+		{"csi", false, "\x1b[1;31m", []string{`csi "" [1;31] m`}},
+		{"csi no params", false, "\x1b[H", []string{`csi "" [] H`}},
+		{"csi omitted", false, "\x1b[;5H", []string{`csi "" [-1;5] H`}},
+		{"csi private", false, "\x1b[?25h", []string{`csi "?" [25] h`}},
+		{"csi intermediate", false, "\x1b[2 q", []string{`csi " " [2] q`}},
+		{"csi subparams", false, "\x1b[38:2::255:0:0m", []string{`csi "" [38:2:-1:255:0:0] m`}},
+		{"csi saturates", false, "\x1b[99999999A", []string{`csi "" [65535] A`}},
+		{"csi with control", false, "\x1b[1\n2A", []string{`exec 0xa`, `csi "" [12] A`}},
+		{"csi bad private", false, "\x1b[1?2Ax", []string{`print 'x'`}},
+		{"csi restart", false, "\x1b[1\x1b[2A", []string{`csi "" [2] A`}},
+		{"osc bel", false, "\x1b]0;title\a", []string{`osc "0;title"`}},
+		{"osc st", false, "\x1b]2;tïtle\x1b\\", []string{`osc "2;tïtle"`, `esc "" \`}},
+		{"osc cancelled", false, "\x1b]0;x\x18", []string{`abort parser: sequence cancelled`, `exec 0x18`}},
+		{"csi cancelled", false, "\x1b[1\x1aA", []string{`abort parser: sequence cancelled`, `exec 0x1a`, `print 'A'`}},
+		{"can in ground", false, "\x18", []string{`exec 0x18`}},
+		{"dcs", false, "\x1bP1;2qab\x1b\\", []string{`hook "" [1;2] q`, `put 'a'`, `put 'b'`, `unhook`, `esc "" \`}},
+		{"dcs intermediate", false, "\x1bP$qm\x1b\\", []string{`hook "$" [] q`, `put 'm'`, `unhook`, `esc "" \`}},
+		{"dcs cancelled", false, "\x1bPqa\x18", []string{`hook "" [] q`, `put 'a'`, `abort parser: sequence cancelled`, `exec 0x18`}},
+		{"apc", false, "\x1b_Gabc\x1b\\x", []string{`apc "Gabc"`, `esc "" \`, `print 'x'`}},
+		{"apc bel", false, "\x1b_Ga=d\a", []string{`apc "Ga=d"`}},
+		{"pm ignored", false, "\x1b^abc\x1b\\x", []string{`esc "" \`, `print 'x'`}},
+		{"c1 in utf8", false, "\u009b5A", []string{`csi "" [5] A`}},
+		{"8-bit csi", true, "\x9b5A", []string{`csi "" [5] A`}},
+		{"8-bit print", true, "\xe9", []string{`print 'é'`}},
+		{"8-bit execute", true, "\x85", []string{`exec 0x85`}},
+		{"8-bit osc", true, "\x9d0;x\x9c", []string{`osc "0;x"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r recorder
+			p := Parser{EightBit: tt.eightBit}
+			p.Parse(&r, []byte(tt.input))
+			if !slices.Equal(r.log, tt.want) {
+				t.Errorf("got %q, want %q", r.log, tt.want)
+			}
+
+			// the same again a byte at a time
+			var split recorder
+			p = Parser{EightBit: tt.eightBit}
+			for i := range len(tt.input) {
+				p.Parse(&split, []byte(tt.input[i:i+1]))
+			}
+			if !slices.Equal(split.log, r.log) {
+				t.Errorf("split: got %q, want %q", split.log, r.log)
+			}
+		})
+	}
+}
+
+func TestParserTooManyParams(t *testing.T) {
+	var r recorder
+	var p Parser
+	p.Parse(&r, []byte("\x1b["+strings.Repeat("1;", MaxParams)+"1m"))
+	if len(r.log) != 0 {
+		t.Errorf("got %q, want nothing", r.log)
+	}
+}
+
+func TestParserMaxString(t *testing.T) {
+	var r recorder
+	p := Parser{MaxString: 4}
+	p.Parse(&r, []byte("\x1b]0;abcdef\ax\x1b]0;ab\a"))
+	want := []string{`abort parser: string too long`, `print 'x'`, `osc "0;ab"`}
+	if !slices.Equal(r.log, want) {
+		t.Errorf("got %q, want %q", r.log, want)
+	}
+}
+
+func TestParserAdvanceRune(t *testing.T) {
+	var r recorder
+	var p Parser
+	for _, c := range "\x1b]0;é\a\u009b5Aü" {
+		p.AdvanceRune(&r, c)
+		if c == 'é' && p.Ground() {
+			t.Error("Ground in the middle of an OSC string")
+		}
+	}
+	want := []string{`osc "0;é"`, `csi "" [5] A`, `print 'ü'`}
+	if !slices.Equal(r.log, want) {
+		t.Errorf("got %q, want %q", r.log, want)
+	}
+	if !p.Ground() {
+		t.Error("not Ground after a complete sequence")
+	}
+}
+
+func TestParamsGet(t *testing.T) {
+	var p Params
+	p.start()
+	p.digit('7')
+	p.next(true)
+	p.digit('3')
+	p.next(false)
+	p.next(false)
+	p.digit('4')
+
+	if p.Len() != 3 {
+		t.Errorf("Len = %d, want 3", p.Len())
+	}
+	for i, want := range []int{7, 1, 4, 1} {
+		if got := p.Get(i, 1); got != want {
+			t.Errorf("Get(%d) = %d, want %d", i, got, want)
+		}
+	}
+	if got := p.Sub(0); !slices.Equal(got, []int{7, 3}) {
+		t.Errorf("Sub(0) = %v", got)
+	}
+}
+
+// nop is a Handler that does nothing.
+type nop struct{}
+
+func (nop) Print(rune)                    {}
+func (nop) Execute(byte)                  {}
+func (nop) ESC(byte, []byte)              {}
+func (nop) CSI(byte, *Params, []byte)     {}
+func (nop) OSC([]byte)                    {}
+func (nop) APC([]byte)                    {}
+func (nop) DCSHook(byte, *Params, []byte) {}
+func (nop) DCSPut(byte)                   {}
+func (nop) DCSUnhook()                    {}
+func (nop) Abort(error)                   {}
+
+func TestParserAllocs(t *testing.T) {
+	input := []byte("plain text ünïcode 😀\r\n\x1b[1;38:2::1:2:3m\x1b[?1049h\x1b]0;title\a\x1bPq#0;2;0;0;0~-\x1b\\\x1b(0")
+	p := new(Parser)
+	var h Handler = nop{}
+	p.Parse(h, input) // let the string buffer grow
+	if n := testing.AllocsPerRun(100, func() { p.Parse(h, input) }); n != 0 {
+		t.Errorf("Parse made %v allocations, want 0", n)
+	}
+}
+
+func BenchmarkParser(b *testing.B) {
+	input := []byte(strings.Repeat("some text \x1b[1;31mred\x1b[m ", 100))
+	p := new(Parser)
+	b.SetBytes(int64(len(input)))
+	for range b.N {
+		p.Parse(nop{}, input)
+	}
+}
@@ -0,0 +1,51 @@
+package fansiterm
+
+import "strings"
+
+// paste.go sends pasted text and focus changes to the host, in the forms
+// asked for by bracketed paste mode (CSI ? 2004 h) and focus reporting
+// (CSI ? 1004 h).
+
+const (
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
+// pasteNewlines turns line endings into CR, which is what the Enter key sends.
+var pasteNewlines = strings.NewReplacer("\r\n", "\r", "\n", "\r")
+
+// Paste sends text to the host through Output as though it were typed, but
+// with bracketed paste on it is wrapped in ESC [ 200 ~ and ESC [ 201 ~ so the
+// program can tell it apart from typing. Any paste markers in text are
+// removed first, so that text can't end the paste early.
+func (d *Device) Paste(text string) error {
+	d.Lock()
+	defer d.Unlock()
+	text = pasteNewlines.Replace(text)
+	if d.Config.BracketedPaste {
+		// removing one marker could join the halves of another
+		for strings.Contains(text, pasteStart) || strings.Contains(text, pasteEnd) {
+			text = strings.ReplaceAll(text, pasteStart, "")
+			text = strings.ReplaceAll(text, pasteEnd, "")
+		}
+		text = pasteStart + text + pasteEnd
+	}
+	_, err := d.Output.Write([]byte(text))
+	return err
+}
+
+// Focus tells the host that the terminal gained (or, if focused is false,
+// lost) focus, if it asked to be told.
+func (d *Device) Focus(focused bool) error {
+	d.Lock()
+	defer d.Unlock()
+	if !d.Config.FocusEvents {
+		return nil
+	}
+	seq := "\x1b[O"
+	if focused {
+		seq = "\x1b[I"
+	}
+	_, err := d.Output.Write([]byte(seq))
+	return err
+}
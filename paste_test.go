@@ -0,0 +1,67 @@
+package fansiterm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPaste(t *testing.T) {
+	tests := []struct {
+		name      string
+		bracketed bool
+		text      string
+		want      string
+	}{
+		{"plain", false, "abc", "abc"},
+		{"newlines", false, "a\nb\r\nc\rd", "a\rb\rc\rd"},
+		{"markers kept unbracketed", false, "a\x1b[201~b", "a\x1b[201~b"},
+		{"bracketed", true, "abc", "\x1b[200~abc\x1b[201~"},
+		{"bracketed newlines", true, "a\r\nb\n", "\x1b[200~a\rb\r\x1b[201~"},
+		{"end marker", true, "a\x1b[201~b", "\x1b[200~ab\x1b[201~"},
+		{"start marker", true, "\x1b[200~a", "\x1b[200~a\x1b[201~"},
+		{"nested end marker", true, "a\x1b[20\x1b[201~1~b", "\x1b[200~ab\x1b[201~"},
+		{"nested start marker", true, "\x1b[2\x1b[200~01~a", "\x1b[200~a\x1b[201~"},
+		{"marker split by a newline", true, "a\x1b[201\n~", "\x1b[200~a\x1b[201\r~\x1b[201~"},
+		{"empty", true, "", "\x1b[200~\x1b[201~"},
+	}
+	for _, tt := range tests {
+		d := New(10, 4, nil)
+		var out bytes.Buffer
+		d.Output = &out
+		if tt.bracketed {
+			d.write([]byte("\x1b[?2004h"))
+		}
+		if err := d.Paste(tt.text); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s: sent %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFocus(t *testing.T) {
+	d := New(10, 4, nil)
+	var out bytes.Buffer
+	d.Output = &out
+
+	d.Focus(true)
+	d.Focus(false)
+	if out.Len() != 0 {
+		t.Errorf("sent %q without focus reporting", out.String())
+	}
+
+	d.write([]byte("\x1b[?1004h"))
+	d.Focus(true)
+	d.Focus(false)
+	if got := out.String(); got != "\x1b[I\x1b[O" {
+		t.Errorf("sent %q, want %q", got, "\x1b[I\x1b[O")
+	}
+
+	out.Reset()
+	d.write([]byte("\x1b[?1004l"))
+	d.Focus(true)
+	if out.Len() != 0 {
+		t.Errorf("sent %q after focus reporting was turned off", out.String())
+	}
+}
@@ -1,7 +1,100 @@
 package fansiterm
 
+// Property identifies one of the miscellaneous string values a host can set
+// on the terminal, like the window title. They are stored in
+// Config.Properties.
 type Property int
 
 const (
+	// PropertyWindowTitle is set by OSC 0 and OSC 2.
 	PropertyWindowTitle Property = iota
+	// PropertyIconName is set by OSC 0 and OSC 1.
+	PropertyIconName
+	// PropertyWorkingDirectory is set by OSC 7, typically a file:// URL.
+	PropertyWorkingDirectory
+	// PropertyFont is a font hint, like "IBM VGA", from the SAUCE record of
+	// ANSI art played with PlayANS.
+	PropertyFont
 )
+
+func (p Property) String() string {
+	switch p {
+	case PropertyWindowTitle:
+		return "WindowTitle"
+	case PropertyIconName:
+		return "IconName"
+	case PropertyWorkingDirectory:
+		return "WorkingDirectory"
+	case PropertyFont:
+		return "Font"
+	default:
+		return "Property(?)"
+	}
+}
+
+// PropertyChange describes a single property update.
+type PropertyChange struct {
+	Property Property
+	Old      string
+	New      string
+}
+
+// titleStackMax limits how many titles CSI 22 t may push. xterm uses 10.
+const titleStackMax = 10
+
+// titleStackEntry is what CSI 22 t saves and CSI 23 t restores. hasWindow
+// and hasIcon say which of the titles were saved.
+type titleStackEntry struct {
+	window, icon       string
+	hasWindow, hasIcon bool
+}
+
+// setProperty stores value under p and, if it changed, notifies PropertyUpdate
+// and ConfigUpdate.
+func (d *Device) setProperty(p Property, value string) {
+	old, ok := d.Config.Properties[p]
+	if ok && old == value {
+		return
+	}
+	d.Config.Properties[p] = value
+	if d.PropertyUpdate != nil {
+		d.PropertyUpdate(PropertyChange{Property: p, Old: old, New: value})
+	}
+	d.configChange()
+}
+
+// pushTitle implements CSI 22 ; which t. which is 0 to save both titles, 1
+// for just the icon name, and 2 for just the window title.
+func (d *Device) pushTitle(which int) {
+	var entry titleStackEntry
+	if which == 0 || which == 1 {
+		entry.icon, entry.hasIcon = d.Config.Properties[PropertyIconName], true
+	}
+	if which == 0 || which == 2 {
+		entry.window, entry.hasWindow = d.Config.Properties[PropertyWindowTitle], true
+	}
+	if !entry.hasIcon && !entry.hasWindow {
+		return
+	}
+	if len(d.titleStack) == titleStackMax {
+		d.titleStack = d.titleStack[1:]
+	}
+	d.titleStack = append(d.titleStack, entry)
+}
+
+// popTitle implements CSI 23 ; which t. which is 0 to restore both titles, 1
+// for just the icon name, and 2 for just the window title. Only the titles
+// that were saved can be restored.
+func (d *Device) popTitle(which int) {
+	if len(d.titleStack) == 0 {
+		return
+	}
+	entry := d.titleStack[len(d.titleStack)-1]
+	d.titleStack = d.titleStack[:len(d.titleStack)-1]
+	if (which == 0 || which == 1) && entry.hasIcon {
+		d.setProperty(PropertyIconName, entry.icon)
+	}
+	if (which == 0 || which == 2) && entry.hasWindow {
+		d.setProperty(PropertyWindowTitle, entry.window)
+	}
+}
@@ -0,0 +1,28 @@
+package fansiterm
+
+import "testing"
+
+func TestTitleStack(t *testing.T) {
+	d := New(10, 4, nil)
+	title := func() (string, string) {
+		return d.Config.Properties[PropertyIconName], d.Config.Properties[PropertyWindowTitle]
+	}
+
+	d.write([]byte("\x1b]1;icon\a\x1b]2;window\a"))
+	// save only the window title, then change both
+	d.write([]byte("\x1b[22;2t\x1b]0;other\a\x1b[23;0t"))
+	if icon, window := title(); icon != "other" || window != "window" {
+		t.Errorf("after saving the title: icon %q, window %q", icon, window)
+	}
+
+	// save both, restore just the icon name
+	d.write([]byte("\x1b]0;both\a\x1b[22;0t\x1b]0;changed\a\x1b[23;1t"))
+	if icon, window := title(); icon != "both" || window != "changed" {
+		t.Errorf("after restoring the icon: icon %q, window %q", icon, window)
+	}
+
+	d.write([]byte("\x1b[22t\x1bc"))
+	if len(d.titleStack) != 0 {
+		t.Errorf("title stack not cleared by reset: %v", d.titleStack)
+	}
+}
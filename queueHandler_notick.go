@@ -10,6 +10,10 @@ func (d *Device) queueHandler() {
 			return
 		case data := <-d.writeQueue:
 			d.write(data)
+		case done := <-d.flushQueue:
+			// writeQueue may have had things in it when this was picked
+			d.drainQueue()
+			close(done)
 		}
 	}
 }
@@ -8,8 +8,8 @@ import (
 
 func (d *Device) queueHandler() {
 	// since I have to have this background goroutine, I could add a tick here
-	// to run periodic tasks... like blinking a curosr
-	tick := time.NewTicker(time.Second / 2)
+	// to run periodic tasks... like blinking a curosr and blinking text
+	tick := time.NewTicker(time.Second / 4)
 	for {
 		select {
 		case <-d.done:
@@ -21,11 +21,13 @@ func (d *Device) queueHandler() {
 					d.useBuf(buf)
 					d.postUpdate()*/
 		case <-tick.C:
-			if d.cursor.show {
-				d.BlinkCursor()
-			}
+			d.blinkTick()
 		case data := <-d.writeQueue:
 			d.write(data)
+		case done := <-d.flushQueue:
+			// writeQueue may have had things in it when this was picked
+			d.drainQueue()
+			close(done)
 		}
 	}
 }
@@ -0,0 +1,513 @@
+package fansiterm
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// regis.go implements a subset of ReGIS, DEC's Remote Graphic Instruction
+// Set, sent as DCS p ... ST. Supported are the P (position), V (vector),
+// C (curve), F (fill), T (text), W (write controls) and S (screen) commands.
+// Everything is drawn with the same primitives as the fansi escape sequences.
+//
+// The logical screen is 800x480 by default and is scaled to Render's bounds;
+// S(A[x1,y1][x2,y2]) changes that.
+
+// regisNamedColors are the color letters accepted by I(...) options.
+var regisNamedColors = map[rune]Color{
+	'D': NewOpaqueColor(0, 0, 0),
+	'R': NewOpaqueColor(255, 0, 0),
+	'G': NewOpaqueColor(0, 255, 0),
+	'B': NewOpaqueColor(0, 0, 255),
+	'C': NewOpaqueColor(0, 255, 255),
+	'Y': NewOpaqueColor(255, 255, 0),
+	'M': NewOpaqueColor(255, 0, 255),
+	'W': NewOpaqueColor(255, 255, 255),
+}
+
+// regisMaxCoord bounds logical coordinates, as on a VT340.
+const regisMaxCoord = 32767
+
+// regisState persists between ReGIS sequences, just as it did on a VT340.
+type regisState struct {
+	init bool
+	// pos is the graphics cursor, in logical coordinates.
+	pos image.Point
+	// addr is the logical address space that maps onto Render's bounds.
+	addr image.Rectangle
+	// mode is the writing mode: R replace, E erase, C complement, V overlay.
+	mode    rune
+	fg, bg  Color
+	palette [16]Color
+}
+
+func (rs *regisState) reset() {
+	*rs = regisState{
+		init: true,
+		addr: image.Rect(0, 0, 800, 480),
+		mode: 'V',
+	}
+	for i, c := range sixelDefaultPalette {
+		rs.palette[i] = sixelRGB(c[0], c[1], c[2])
+	}
+	rs.fg = rs.palette[7]
+	rs.bg = rs.palette[0]
+}
+
+type regisParser struct {
+	d    *Device
+	s    *regisState
+	data []rune
+	i    int
+	// fill collects vertices, in pixels, while parsing the inside of F(...).
+	fill *[]image.Point
+}
+
+// handleReGIS runs ReGIS commands. args are the DCS parameters; an odd P1
+// resets the ReGIS state first.
+func (d *Device) handleReGIS(args []int, data []rune) {
+	if !d.regis.init || args[0]%2 == 1 {
+		d.regis.reset()
+	}
+	p := &regisParser{d: d, s: &d.regis, data: data}
+	p.run()
+}
+
+func (p *regisParser) run() {
+	for p.i < len(p.data) {
+		switch regisUpper(p.next()) {
+		case 'P':
+			p.position()
+		case 'V':
+			p.vector()
+		case 'C':
+			p.curve()
+		case 'F':
+			p.fillCmd()
+		case 'T':
+			p.text()
+		case 'W':
+			p.writeControls()
+		case 'S':
+			p.screen()
+		case '(', '[', '\'', '"':
+			// arguments to an unsupported command
+			p.i--
+			p.skipArgs()
+		default:
+			// ; resynchronizes, whitespace is ignored, and unsupported
+			// commands are skipped along with their arguments
+		}
+	}
+}
+
+func (p *regisParser) next() rune {
+	r := p.data[p.i]
+	p.i++
+	return r
+}
+
+// peek returns the next rune that isn't whitespace (or some other control
+// character), or 0 at the end.
+func (p *regisParser) peek() rune {
+	for p.i < len(p.data) && p.data[p.i] <= ' ' {
+		p.i++
+	}
+	if p.i >= len(p.data) {
+		return 0
+	}
+	return p.data[p.i]
+}
+
+// number reads an optionally signed integer. rel is true if it had a sign.
+func (p *regisParser) number() (n int, rel, ok bool) {
+	neg := false
+	switch p.peek() {
+	case '+':
+		rel = true
+		p.i++
+	case '-':
+		rel, neg = true, true
+		p.i++
+	}
+	for p.i < len(p.data) && p.data[p.i] >= '0' && p.data[p.i] <= '9' {
+		n = min(n*10+int(p.data[p.i]-'0'), regisMaxCoord)
+		ok = true
+		p.i++
+	}
+	if neg {
+		n = -n
+	}
+	return
+}
+
+// coord reads [x,y] and returns the logical point it refers to. Either
+// coordinate may be left out, or made relative to the graphics cursor with
+// a sign.
+func (p *regisParser) coord() image.Point {
+	pt := p.s.pos
+	p.i++ // [
+	if n, rel, ok := p.number(); ok {
+		if rel {
+			pt.X += n
+		} else {
+			pt.X = n
+		}
+	}
+	if p.peek() == ',' {
+		p.i++
+		if n, rel, ok := p.number(); ok {
+			if rel {
+				pt.Y += n
+			} else {
+				pt.Y = n
+			}
+		}
+	}
+	for p.i < len(p.data) && p.data[p.i] != ']' {
+		p.i++
+	}
+	p.i++ // ]
+	pt.X = bound(pt.X, -regisMaxCoord, regisMaxCoord)
+	pt.Y = bound(pt.Y, -regisMaxCoord, regisMaxCoord)
+	return pt
+}
+
+// group reads a parenthesized option list and returns what is inside it.
+func (p *regisParser) group() []rune {
+	p.i++ // (
+	start, depth := p.i, 1
+	for ; p.i < len(p.data); p.i++ {
+		switch p.data[p.i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				p.i++
+				return p.data[start : p.i-1]
+			}
+		}
+	}
+	return p.data[start:]
+}
+
+// str reads a quoted string. Doubling the quote character escapes it.
+func (p *regisParser) str() string {
+	quote := p.next()
+	var out []rune
+	for p.i < len(p.data) {
+		r := p.next()
+		if r == quote {
+			if p.i < len(p.data) && p.data[p.i] == quote {
+				p.i++
+			} else {
+				break
+			}
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+// skipArgs skips over arguments of unsupported commands.
+func (p *regisParser) skipArgs() {
+	for {
+		switch p.peek() {
+		case '[':
+			p.coord()
+		case '(':
+			p.group()
+		case '\'', '"':
+			p.str()
+		default:
+			return
+		}
+	}
+}
+
+// toPixel converts a logical point into Render's coordinates.
+func (p *regisParser) toPixel(pt image.Point) image.Point {
+	b, a := p.d.Render.Bounds(), p.s.addr
+	if a.Dx() == 0 || a.Dy() == 0 {
+		return b.Min
+	}
+	return image.Pt(
+		b.Min.X+(pt.X-a.Min.X)*b.Dx()/a.Dx(),
+		b.Min.Y+(pt.Y-a.Min.Y)*b.Dy()/a.Dy(),
+	)
+}
+
+// scaleX converts a logical distance to pixels along the X axis.
+func (p *regisParser) scaleX(n int) int {
+	if p.s.addr.Dx() == 0 {
+		return 0
+	}
+	return abs(n * p.d.Render.Bounds().Dx() / p.s.addr.Dx())
+}
+
+// target returns what to draw on and with, according to the writing mode.
+func (p *regisParser) target() (draw.Image, color.Color) {
+	switch p.s.mode {
+	case 'E':
+		return p.d.Render, p.s.bg
+	case 'C':
+		return complementImage{p.d.Render}, p.s.fg
+	default:
+		return p.d.Render, p.s.fg
+	}
+}
+
+// color parses the argument of an I option: a register number or a
+// parenthesized color letter.
+func (p *regisParser) color() (Color, bool) {
+	if p.peek() == '(' {
+		g := p.group()
+		for _, r := range g {
+			if c, ok := regisNamedColors[regisUpper(r)]; ok {
+				return c, true
+			}
+		}
+		return Color{}, false
+	}
+	n, _, ok := p.number()
+	if !ok {
+		return Color{}, false
+	}
+	return p.s.palette[bound(n, 0, len(p.s.palette)-1)], true
+}
+
+// sub returns a parser for the inside of an option group that shares state
+// with p.
+func (p *regisParser) sub(data []rune) *regisParser {
+	return &regisParser{d: p.d, s: p.s, data: data, fill: p.fill}
+}
+
+// position implements P[x,y]: move the graphics cursor without drawing.
+func (p *regisParser) position() {
+	for {
+		switch p.peek() {
+		case '[':
+			p.s.pos = p.coord()
+			if p.fill != nil {
+				*p.fill = append(*p.fill, p.toPixel(p.s.pos))
+			}
+		case '(':
+			p.group()
+		default:
+			return
+		}
+	}
+}
+
+// line draws a line from a to b. Unlike drawLine, a ReGIS line includes its
+// end point, so that V[] plots a dot and the last point of a polyline is
+// drawn, as on a VT340.
+func (p *regisParser) line(a, b image.Point) {
+	dst, c := p.target()
+	a, b = p.toPixel(a), p.toPixel(b)
+	drawLine(dst, a, b, c)
+	dst.Set(b.X, b.Y, c)
+}
+
+// vector implements V[x,y]...: draw lines from the graphics cursor through
+// each point. V[] plots a single dot.
+func (p *regisParser) vector() {
+	for {
+		switch p.peek() {
+		case '[':
+			to := p.coord()
+			if p.fill != nil {
+				*p.fill = append(*p.fill, p.toPixel(to))
+			} else {
+				p.line(p.s.pos, to)
+			}
+			p.s.pos = to
+		case '(':
+			p.group()
+		default:
+			return
+		}
+	}
+}
+
+// curve implements C[x,y]: a circle around the graphics cursor through
+// [x,y]. With C(C)[x,y], [x,y] is the center and the cursor is on the
+// circle. C(A degrees) draws an arc instead, counterclockwise for positive
+// angles, starting from the point on the circle.
+func (p *regisParser) curve() {
+	var centered bool
+	var arc float64
+	for {
+		switch p.peek() {
+		case '(':
+			opts := p.sub(p.group())
+			for opts.i < len(opts.data) {
+				switch regisUpper(opts.next()) {
+				case 'C':
+					centered = true
+				case 'A':
+					n, _, _ := opts.number()
+					arc = float64(n)
+				}
+			}
+		case '[':
+			pt := p.coord()
+			center, edge := p.s.pos, pt
+			if centered {
+				center, edge = pt, p.s.pos
+			}
+			p.circle(center, edge, arc)
+			// the cursor ends up at the center of the circle
+			p.s.pos = center
+		default:
+			return
+		}
+	}
+}
+
+// circle draws (or, inside F, collects the outline of) a circle or arc.
+func (p *regisParser) circle(center, edge image.Point, arc float64) {
+	dx, dy := float64(edge.X-center.X), float64(edge.Y-center.Y)
+	radius := math.Hypot(dx, dy)
+
+	full := arc == 0 || math.Abs(arc) >= 360
+	if full && p.fill == nil {
+		dst, col := p.target()
+		drawCircle(dst, p.toPixel(center), p.scaleX(int(math.Round(radius))), col)
+		return
+	}
+
+	// Approximate arcs with one segment every 5 degrees or so. Inside F a
+	// circle is outlined the same way, but without going through the center
+	// as an arc does.
+	pts := []image.Point{p.toPixel(center), p.toPixel(edge)}
+	if full {
+		arc = 360
+		pts = pts[1:]
+	}
+	start := math.Atan2(dy, dx)
+	steps := max(int(math.Abs(arc)/5), 1)
+	prev := edge
+	for i := 1; i <= steps; i++ {
+		// screen y grows downward, so counterclockwise means subtracting
+		theta := start - arc*math.Pi/180*float64(i)/float64(steps)
+		pt := image.Pt(
+			center.X+int(math.Round(radius*math.Cos(theta))),
+			center.Y+int(math.Round(radius*math.Sin(theta))),
+		)
+		if p.fill == nil {
+			p.line(prev, pt)
+		}
+		pts = append(pts, p.toPixel(pt))
+		prev = pt
+	}
+	if p.fill != nil {
+		*p.fill = append(*p.fill, pts...)
+	}
+}
+
+// fillCmd implements F(...): the V and C commands inside the parentheses
+// outline a shape which is filled instead of drawn.
+func (p *regisParser) fillCmd() {
+	for p.peek() == '(' {
+		var pts []image.Point
+		pts = append(pts, p.toPixel(p.s.pos))
+		inner := p.sub(p.group())
+		inner.fill = &pts
+		inner.run()
+		dst, c := p.target()
+		fillPolygon(dst, pts, c)
+	}
+}
+
+// text implements T'string': draw text with the current character set at
+// the graphics cursor, which is the top left corner of the first cell.
+func (p *regisParser) text() {
+	for {
+		switch p.peek() {
+		case '\'', '"':
+			dst, fg := p.target()
+			cell := p.d.Render.cell.Size()
+			for _, r := range p.str() {
+				(*p.d.Render.active.tileSet).DrawTile(r, dst, p.toPixel(p.s.pos), fg, p.s.bg)
+				if b := p.d.Render.Bounds().Dx(); b != 0 {
+					p.s.pos.X += cell.X * p.s.addr.Dx() / b
+				}
+			}
+		case '(':
+			// text options, like size and spacing, are not supported
+			p.group()
+		case '[':
+			p.coord()
+		default:
+			return
+		}
+	}
+}
+
+// writeControls implements W(...): I sets the color, and E, R, C and V
+// select erase, replace, complement and overlay writing.
+func (p *regisParser) writeControls() {
+	for p.peek() == '(' {
+		opts := p.sub(p.group())
+		for opts.i < len(opts.data) {
+			switch r := regisUpper(opts.next()); r {
+			case 'I':
+				if c, ok := opts.color(); ok {
+					p.s.fg = c
+				}
+			case 'E', 'R', 'C', 'V':
+				p.s.mode = r
+			case '(':
+				// options we don't support, like patterns, may have arguments
+				opts.i--
+				opts.group()
+			}
+		}
+	}
+}
+
+// screen implements S(...): E erases the screen, I sets the background
+// color, and A[x1,y1][x2,y2] sets the logical address space.
+func (p *regisParser) screen() {
+	for p.peek() == '(' {
+		opts := p.sub(p.group())
+		for opts.i < len(opts.data) {
+			switch regisUpper(opts.next()) {
+			case 'E':
+				p.d.Render.Fill(p.d.Render.Bounds(), p.s.bg)
+			case 'I':
+				if c, ok := opts.color(); ok {
+					p.s.bg = c
+				}
+			case 'A':
+				var corners []image.Point
+				for opts.peek() == '[' {
+					corners = append(corners, opts.coord())
+				}
+				if len(corners) == 2 {
+					p.s.addr = image.Rectangle{Min: corners[0], Max: corners[1].Add(image.Pt(1, 1))}
+				}
+			}
+		}
+	}
+}
+
+// regisUpper upper cases ASCII letters; ReGIS commands and options are case
+// insensitive.
+func regisUpper(r rune) rune {
+	if r >= 'a' && r <= 'z' {
+		return r - 'a' + 'A'
+	}
+	return r
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,69 @@
+package fansiterm
+
+import (
+	"image"
+	"testing"
+	"time"
+)
+
+func TestReGISFillCircle(t *testing.T) {
+	d := New(100, 30, nil)
+	// the logical screen maps one to one onto the pixels
+	d.write([]byte("\x1bPpS(A[0,0][799,479])P[400,240]F(C[+100])\x1b\\"))
+
+	r, g, b, _ := d.regis.fg.RGBA()
+	for _, tt := range []struct {
+		pt   image.Point
+		want bool
+	}{
+		{image.Pt(400, 240), true},
+		{image.Pt(400, 160), true},
+		{image.Pt(470, 240), true},
+		{image.Pt(400, 100), false},
+		{image.Pt(480, 320), false},
+	} {
+		pr, pg, pb, _ := d.Render.At(tt.pt.X, tt.pt.Y).RGBA()
+		if got := pr == r && pg == g && pb == b; got != tt.want {
+			t.Errorf("%v filled: %v, want %v", tt.pt, got, tt.want)
+		}
+	}
+}
+
+func TestReGISHugeFill(t *testing.T) {
+	d := New(100, 30, nil)
+	done := make(chan struct{})
+	go func() {
+		d.write([]byte("\x1bPpP[400,240]F(C[+1000000])F(V[-9999999,-9999999][+9999999,+9999999][-9999999,+9999999])\x1b\\"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("filling shapes far bigger than the screen took too long")
+	}
+}
+
+func TestReGISVector(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cmds string
+		set  []image.Point
+	}{
+		{"dot", "P[100,100]V[]", []image.Point{{100, 100}}},
+		{"line", "P[100,100]V[110,100]", []image.Point{{100, 100}, {105, 100}, {110, 100}}},
+		{"polyline", "P[100,100]V[110,100][110,120]", []image.Point{{110, 100}, {110, 110}, {110, 120}}},
+	} {
+		d := New(100, 30, nil)
+		// the corners are inclusive, so this maps one to one onto the pixels
+		d.write([]byte("\x1bPpS(A[0,0][799,479])" + tt.cmds + "\x1b\\"))
+		r, g, b, _ := d.regis.fg.RGBA()
+		for _, pt := range tt.set {
+			if pr, pg, pb, _ := d.Render.At(pt.X, pt.Y).RGBA(); pr != r || pg != g || pb != b {
+				t.Errorf("%s: %v not drawn", tt.name, pt)
+			}
+		}
+		if pr, pg, pb, _ := d.Render.At(111, 121).RGBA(); pr == r && pg == g && pb == b {
+			t.Errorf("%s: drawn past the end", tt.name)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
+	"math"
 
 	"github.com/mattn/go-runewidth"
 	"github.com/sparques/fansiterm/tiles"
@@ -61,6 +62,9 @@ func (d *Device) updateAttr() {
 	if d.attr.Reversed {
 		d.Render.active.fg, d.Render.active.bg = d.attr.Bg, d.attr.Fg
 	}
+	if d.attr.Faint {
+		d.Render.active.fg = blendColor(d.Render.active.fg, d.Render.active.bg, 96)
+	}
 
 	switch d.Render.active.g[d.Render.active.shift] {
 	case &d.Render.CharSet:
@@ -98,19 +102,33 @@ func (d *Device) cursorPt() image.Point {
 // RenderRune does not do *any* interpretation of escape codes or control characters like \r or \n.
 // It simply renders a single rune at the cursor position. It is up to the caller
 // of RenderRune to process any control sequences / handle non-printing characters.
+// A zero-width rune on its own is drawn over a blank cell; use RenderCluster
+// to combine it with a base character.
 func (d *Device) RenderRune(sym rune) (width int) {
-	width = 1
-	if sym > 255 {
-		// do runewidth check and adjusted width as necessary
-		width = unicode.RuneWidth(sym)
+	return d.RenderCluster([]rune{sym})
+}
+
+// RenderCluster renders a single grapheme cluster at the cursor position,
+// returning how many cells it took up. Like RenderRune, it does no
+// interpretation of control characters.
+func (d *Device) RenderCluster(cluster []rune) (width int) {
+	if len(cluster) == 0 {
+		return 0
 	}
+	width = d.renderCluster(cluster)
+	d.trackBlink(cluster)
+	return
+}
 
-	if width == 0 {
-		// FIXME: corner case of using a zero-width (combining) character
-		// when we're in the last column
-		(*d.Render.active.tileSet).DrawTile(sym, d.Render, d.cursorPt().Add(image.Pt(-d.Render.cell.Dx(), 0)), d.Render.active.fg, color.Alpha{0})
+// renderCluster does the actual drawing for RenderCluster, without touching
+// the record of blinking cells.
+func (d *Device) renderCluster(cluster []rune) (width int) {
+	width = clusterWidth(cluster)
+
+	if d.attr.Superscript || d.attr.Subscript {
+		d.drawScript(cluster, width)
 	} else {
-		(*d.Render.active.tileSet).DrawTile(sym, d.Render, d.cursorPt(), d.Render.active.fg, d.Render.active.bg)
+		d.drawCluster(d.Render, d.cursorPt(), cluster, width)
 	}
 
 	if d.attr.Strike {
@@ -128,27 +146,21 @@ func (d *Device) RenderRune(sym rune) (width int) {
 	}
 
 	if d.attr.Underline {
-		// draw a single pixel high line through the the whole cell, 3px above the bottom of the cell
-		draw.Draw(d.Render,
-			image.Rect(
-				0,
-				d.Render.cell.Dy()-1,
-				d.Render.cell.Dx()*width,
-				d.Render.cell.Dy()).Add(d.cursorPt()),
-			d.Render.active.fg,
-			image.Point{},
-			draw.Src)
-		// draw second line for double underline
-		if d.attr.DoubleUnderline {
-			draw.Draw(d.Render,
-				image.Rect(
-					0,
-					d.Render.cell.Dy()-3,
-					d.Render.cell.Dx()*width,
-					d.Render.cell.Dy()-2).Add(d.cursorPt()),
-				d.Render.active.fg,
-				image.Point{},
-				draw.Src)
+		d.drawUnderline(width)
+	}
+
+	if d.attr.Overline {
+		thick := max(d.Render.cell.Dy()/16, 1)
+		d.Render.Fill(image.Rect(0, 0, d.Render.cell.Dx()*width, thick).Add(d.cursorPt()), d.Render.active.fg)
+	}
+
+	if d.attr.Framed || d.attr.Encircled {
+		// drawBox and drawEllipse include Max
+		box := image.Rect(0, 0, d.Render.cell.Dx()*width-1, d.Render.cell.Dy()-1).Add(d.cursorPt())
+		if d.attr.Framed {
+			drawBox(d.Render, box, d.Render.active.fg)
+		} else {
+			drawEllipse(d.Render, box, d.Render.active.fg)
 		}
 	}
 
@@ -164,6 +176,96 @@ func (d *Device) RenderRune(sym rune) (width int) {
 	return
 }
 
+// drawUnderline draws the underline for a rune width cells wide at the
+// cursor. The underline's thickness and the amplitude of curly underlines
+// scale with the height of a cell.
+func (d *Device) drawUnderline(width int) {
+	c := d.Render.active.fg
+	if d.attr.UnderlineColored {
+		c = d.attr.UnderlineColor
+	}
+
+	cell := d.Render.cell.Size()
+	thick := max(cell.Y/16, 1)
+	w := cell.X * width
+	pt := d.cursorPt()
+
+	switch {
+	case d.attr.DoubleUnderline:
+		d.Render.Fill(image.Rect(0, cell.Y-thick, w, cell.Y).Add(pt), c)
+		d.Render.Fill(image.Rect(0, cell.Y-3*thick, w, cell.Y-2*thick).Add(pt), c)
+	case d.attr.UnderlineStyle == UnderlineCurly:
+		// one period of a sine wave per cell so neighbors line up
+		amp := max(cell.Y/10, 1)
+		mid := cell.Y - thick - amp
+		for x := range w {
+			y := mid + int(math.Round(float64(amp)*math.Sin(2*math.Pi*float64(x)/float64(cell.X))))
+			d.Render.Fill(image.Rect(x, y, x+1, y+thick).Add(pt), c)
+		}
+	case d.attr.UnderlineStyle == UnderlineDotted:
+		for x := 0; x < w; x += 2 * thick {
+			d.Render.Fill(image.Rect(x, cell.Y-thick, x+thick, cell.Y).Add(pt), c)
+		}
+	case d.attr.UnderlineStyle == UnderlineDashed:
+		// three quarters on, one quarter off, twice per cell
+		period := max(cell.X/2, 2)
+		for x := 0; x < w; x += period {
+			d.Render.Fill(image.Rect(x, cell.Y-thick, x+max(period*3/4, 1), cell.Y).Add(pt), c)
+		}
+	default:
+		d.Render.Fill(image.Rect(0, cell.Y-thick, w, cell.Y).Add(pt), c)
+	}
+}
+
+// drawCluster draws the glyphs of cluster, width cells wide, at pt in dst:
+// the first rune as a normal tile and any combining marks on top of it.
+func (d *Device) drawCluster(dst draw.Image, pt image.Point, cluster []rune, width int) {
+	tileSet := *d.Render.active.tileSet
+	fg, bg := d.Render.active.fg, d.Render.active.bg
+	base := cluster[0]
+
+	if width > runeWidth(base) {
+		// e.g. a narrow symbol made wide by VS16; the tile won't cover
+		// the whole area
+		draw.Draw(dst, image.Rect(0, 0, d.Render.cell.Dx()*width, d.Render.cell.Dy()).Add(pt), bg, image.Point{}, draw.Src)
+	}
+	tileSet.DrawTile(base, dst, pt, fg, bg)
+
+	for _, r := range cluster[1:] {
+		switch {
+		case r == zeroWidthJoiner:
+			// there are no tiles for ZWJ sequences; the first emoji
+			// stands in for the lot
+			return
+		case isVariationSelector(r):
+			// only affects the width
+		case isRegionalIndicator(base) && isRegionalIndicator(r):
+			// flags get drawn as their two letters
+			tileSet.DrawTile(r, dst, pt.Add(image.Pt(d.Render.cell.Dx(), 0)), fg, bg)
+		default:
+			// a missing tile would be drawn as a block over the base
+			if _, ok := tileSet.GetTile(r); ok {
+				tileSet.DrawTile(r, dst, pt, fg, color.Alpha{0})
+			}
+		}
+	}
+}
+
+// drawScript draws cluster squashed into the top half of the cell for
+// superscript, or the bottom half for subscript.
+func (d *Device) drawScript(cluster []rune, width int) {
+	cell := image.Rect(0, 0, d.Render.cell.Dx()*width, d.Render.cell.Dy())
+	tile := image.NewRGBA(cell)
+	d.drawCluster(tile, image.Point{}, cluster, width)
+
+	d.Render.Fill(cell.Add(d.cursorPt()), d.Render.active.bg)
+	half := image.Rect(0, 0, cell.Dx(), cell.Dy()/2).Add(d.cursorPt())
+	if d.attr.Subscript {
+		half = half.Add(image.Pt(0, cell.Dy()/2))
+	}
+	draw.Draw(d.Render, half, xform.Scale(tile, half), half.Min, draw.Src)
+}
+
 func blockRect(cell image.Rectangle, pt image.Point) image.Rectangle {
 	return cell.Add(pt)
 }
@@ -177,7 +279,12 @@ func underscoreRect(cell image.Rectangle, pt image.Point) image.Rectangle {
 }
 
 func (d *Device) toggleCursor() {
-	rect := d.Render.cursorFunc(d.Render.cell, d.cursorPt())
+	pt := d.cursorPt()
+	if d.cursor.col >= d.cols {
+		// a wrap is pending; show the cursor on the last column
+		pt.X -= d.Render.cell.Dx() * (d.cursor.col - d.cols + 1)
+	}
+	rect := d.Render.cursorFunc(d.Render.cell, pt)
 	d.cursor.visible = !d.cursor.visible
 
 	draw.Draw(d.Render,
@@ -213,10 +320,12 @@ func (d *Device) Clear(x1, y1, x2, y2 int) {
 		x2*d.Render.cell.Dx(), y2*d.Render.cell.Dy())
 
 	d.Render.Fill(rect.Add(d.Render.bounds.Min), d.attr.Bg)
+	d.clearBlink(x1, y1, x2, y2)
 }
 
 func (d *Device) clearAll() {
 	d.Render.Fill(d.Render.bounds, d.attr.Bg)
+	d.blink.cells = nil
 }
 
 // Bounds returns the image.Rectangle that aligns with terminal cell boundaries
@@ -7,6 +7,7 @@ import (
 func (d *Device) Scroll(rowAmount int) {
 	// scrollArea Empty means scroll the whole screen--we can use more efficient algos for that
 	if d.scrollArea.Empty() {
+		d.scrollBlink(0, d.rows-1, rowAmount)
 		d.Render.Scroll(rowAmount * d.Render.cell.Dy())
 		// fill in scrolls section with background
 		if rowAmount > 0 {
@@ -18,6 +19,7 @@ func (d *Device) Scroll(rowAmount int) {
 	}
 
 	// scrollArea is set; must scroll a subsection
+	d.scrollBlink(d.scrollRegion[0], d.scrollRegion[1], rowAmount)
 	d.Render.RegionScroll(d.scrollArea, rowAmount*d.Render.cell.Dy())
 
 	// fill in scrolls section with background
@@ -28,6 +30,16 @@ func (d *Device) Scroll(rowAmount int) {
 	}
 }
 
+// index moves the cursor down a row, scrolling if it's on the last row of the
+// scroll region.
+func (d *Device) index() {
+	if d.cursor.row == d.scrollRegion[1] {
+		d.Scroll(1)
+	} else if d.cursor.row < d.rows-1 {
+		d.cursor.row++
+	}
+}
+
 func (d *Device) VectorScrollCells(c1, r1, c2, r2, cn, rn int) {
 }
 
@@ -0,0 +1,196 @@
+package fansiterm
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"slices"
+
+	"github.com/sparques/fansiterm/xform"
+)
+
+// shapes.go has the pixel drawing primitives shared by the fansi escape
+// sequences and ReGIS. Coordinates are absolute; callers add Render's offset.
+
+// drawLine draws a line from pt1 up to, but not including, pt2 using
+// Bresenham's algorithm.
+func drawLine(dst draw.Image, pt1, pt2 image.Point, c color.Color) {
+	var swap bool
+
+	dx := pt1.X - pt2.X
+	dy := pt1.Y - pt2.Y
+
+	var x_step, y_step int
+
+	if dx < 0 {
+		dx *= -1
+	}
+	if dy < 0 {
+		dy *= -1
+	}
+
+	if dy > dx {
+		dx, dy = dy, dx
+		pt1.X, pt1.Y = pt1.Y, pt1.X
+		pt2.X, pt2.Y = pt2.Y, pt2.X
+		swap = true
+	}
+
+	if pt1.X < pt2.X {
+		x_step = 1
+	} else {
+		x_step = -1
+	}
+	if pt1.Y < pt2.Y {
+		y_step = 1
+	} else {
+		y_step = -1
+	}
+	p := 2*dy - dx
+
+	x, y := pt1.X, pt1.Y
+	for range dx {
+		if swap {
+			dst.Set(y, x, c)
+		} else {
+			dst.Set(x, y, c)
+		}
+		if p >= 0 {
+			y += y_step
+			p -= 2 * dx
+		}
+		x += x_step
+		p += 2 * dy
+	}
+}
+
+// drawBox draws the outline of rect. Unlike most things image, rect.Max is
+// included.
+func drawBox(dst draw.Image, rect image.Rectangle, c color.Color) {
+	rect = rect.Canon()
+	for x := rect.Min.X; x <= rect.Max.X; x++ {
+		dst.Set(x, rect.Min.Y, c)
+		dst.Set(x, rect.Max.Y, c)
+	}
+	for y := rect.Min.Y; y <= rect.Max.Y; y++ {
+		dst.Set(rect.Min.X, y, c)
+		dst.Set(rect.Max.X, y, c)
+	}
+}
+
+// drawCircle draws the outline of a circle using Bresenham's method.
+func drawCircle(dst draw.Image, center image.Point, r int, c color.Color) {
+	x, y := center.X, center.Y
+	xp := 0
+	yp := r
+	de := 3 - 2*r
+	for xp <= yp {
+		dst.Set(xp+x, yp+y, c)
+		dst.Set(xp+x, -yp+y, c)
+		dst.Set(-xp+x, yp+y, c)
+		dst.Set(-xp+x, -yp+y, c)
+		dst.Set(yp+x, xp+y, c)
+		dst.Set(yp+x, -xp+y, c)
+		dst.Set(-yp+x, xp+y, c)
+		dst.Set(-yp+x, -xp+y, c)
+		if de < 0 {
+			de = de + 4*xp + 6
+		} else {
+			de = de + 4*(xp-yp) + 10
+			yp--
+		}
+		xp++
+	}
+}
+
+// fillCircle draws a filled circle by testing every pixel of its bounding box
+// that is within dst's bounds.
+func fillCircle(dst draw.Image, center image.Point, r int, c color.Color) {
+	bounds := dst.Bounds()
+	r2 := int64(r) * int64(r)
+	for y := max(-r, bounds.Min.Y-center.Y); y <= min(r, bounds.Max.Y-1-center.Y); y++ {
+		for x := max(-r, bounds.Min.X-center.X); x <= min(r, bounds.Max.X-1-center.X); x++ {
+			if r2 >= int64(x)*int64(x)+int64(y)*int64(y) {
+				dst.Set(center.X+x, center.Y+y, c)
+			}
+		}
+	}
+}
+
+// drawEllipse draws the outline of the ellipse inscribed in rect. Like
+// drawBox, rect.Max is included. Both axes are stepped along so that steep
+// parts of the curve don't leave gaps.
+func drawEllipse(dst draw.Image, rect image.Rectangle, c color.Color) {
+	rect = rect.Canon()
+	cx := float64(rect.Min.X+rect.Max.X) / 2
+	cy := float64(rect.Min.Y+rect.Max.Y) / 2
+	rx := float64(rect.Dx()) / 2
+	ry := float64(rect.Dy()) / 2
+	if rx == 0 || ry == 0 {
+		drawLine(dst, rect.Min, rect.Max, c)
+		return
+	}
+	for x := rect.Min.X; x <= rect.Max.X; x++ {
+		dx := (float64(x) - cx) / rx
+		dy := ry * math.Sqrt(max(1-dx*dx, 0))
+		dst.Set(x, int(math.Round(cy-dy)), c)
+		dst.Set(x, int(math.Round(cy+dy)), c)
+	}
+	for y := rect.Min.Y; y <= rect.Max.Y; y++ {
+		dy := (float64(y) - cy) / ry
+		dx := rx * math.Sqrt(max(1-dy*dy, 0))
+		dst.Set(int(math.Round(cx-dx)), y, c)
+		dst.Set(int(math.Round(cx+dx)), y, c)
+	}
+}
+
+// fillPolygon fills the polygon with vertices pts using the even-odd rule.
+// Only the part within dst's bounds is visited.
+func fillPolygon(dst draw.Image, pts []image.Point, c color.Color) {
+	if len(pts) < 3 {
+		return
+	}
+	minY, maxY := pts[0].Y, pts[0].Y
+	for _, pt := range pts {
+		minY = min(minY, pt.Y)
+		maxY = max(maxY, pt.Y)
+	}
+	bounds := dst.Bounds()
+	minY, maxY = max(minY, bounds.Min.Y), min(maxY, bounds.Max.Y-1)
+
+	var xs []int
+	for y := minY; y <= maxY; y++ {
+		xs = xs[:0]
+		for i := range pts {
+			a, b := pts[i], pts[(i+1)%len(pts)]
+			if a.Y == b.Y {
+				continue
+			}
+			if a.Y > b.Y {
+				a, b = b, a
+			}
+			// half open so shared vertices aren't counted twice
+			if y < a.Y || y >= b.Y {
+				continue
+			}
+			xs = append(xs, a.X+int(int64(y-a.Y)*int64(b.X-a.X)/int64(b.Y-a.Y)))
+		}
+		slices.Sort(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			for x := max(xs[i], bounds.Min.X); x <= min(xs[i+1], bounds.Max.X-1); x++ {
+				dst.Set(x, y, c)
+			}
+		}
+	}
+}
+
+// complementImage wraps a draw.Image so that Set inverts whatever is already
+// there instead of drawing a color.
+type complementImage struct {
+	draw.Image
+}
+
+func (ci complementImage) Set(x, y int, _ color.Color) {
+	ci.Image.Set(x, y, xform.InvertColors(ci.Image).At(x, y))
+}
@@ -0,0 +1,266 @@
+package fansiterm
+
+import (
+	"image"
+	"math"
+)
+
+// sixel.go implements a decoder for DEC sixel graphics, DCS P1;P2;P3 q ... ST.
+// Sixels are drawn straight to Render as they are decoded, so no image buffer
+// is ever allocated.
+
+// sixelRegisters is how many color registers a sixel image may use.
+const sixelRegisters = 256
+
+// sixelDefaultPalette is the VT340's power-on color map, in percent RGB.
+var sixelDefaultPalette = [16][3]int{
+	{0, 0, 0},
+	{20, 20, 80},
+	{80, 13, 13},
+	{20, 80, 20},
+	{80, 20, 80},
+	{20, 80, 80},
+	{80, 80, 20},
+	{53, 53, 53},
+	{26, 26, 26},
+	{33, 33, 60},
+	{60, 26, 26},
+	{33, 60, 33},
+	{60, 33, 60},
+	{33, 60, 60},
+	{60, 60, 33},
+	{80, 80, 80},
+}
+
+type sixelDecoder struct {
+	d *Device
+	// origin is the top left corner of the image, in Render's coordinates.
+	origin image.Point
+	// pos is the sixel cursor relative to origin. Y is the top of the current
+	// band.
+	pos image.Point
+	// extent is the bottom right corner of everything drawn so far, relative
+	// to origin.
+	extent image.Point
+	// aspect is how many pixels tall each sixel bit is.
+	aspect int
+	// transparent is set when P2 is 1; otherwise the raster area is filled
+	// with color register 0.
+	transparent bool
+	// scrolling is DECSDM reset: the image is placed at the cursor and the
+	// screen scrolls to fit it.
+	scrolling bool
+	palette   [sixelRegisters]Color
+	color     Color
+}
+
+// handleSixel decodes and draws sixel data. args are P1 through P3. P1, the
+// aspect ratio, is ignored like most modern terminals do; the raster
+// attributes set it instead. P3, the grid size, is ignored entirely.
+func (d *Device) handleSixel(args []int, data []rune) {
+	for len(args) < 3 {
+		args = append(args, 0)
+	}
+	sd := &sixelDecoder{
+		d:           d,
+		aspect:      1,
+		transparent: args[1] == 1,
+		scrolling:   d.Config.SixelScrolling,
+		color:       d.Render.active.fg,
+	}
+	for i, c := range sixelDefaultPalette {
+		sd.palette[i] = sixelRGB(c[0], c[1], c[2])
+	}
+	for i := len(sixelDefaultPalette); i < sixelRegisters; i++ {
+		sd.palette[i] = sd.palette[0]
+	}
+
+	if sd.scrolling {
+		sd.origin = d.cursorPt()
+	} else {
+		sd.origin = d.Render.bounds.Min
+	}
+
+	sd.decode(data)
+
+	if !sd.scrolling || sd.extent.Y == 0 {
+		return
+	}
+
+	// Leave the cursor on the line following the image, in the column the
+	// image started in.
+	bottom := sd.origin.Y + sd.extent.Y - 1 - d.Render.bounds.Min.Y
+	d.cursor.row = bound(bottom/d.Render.cell.Dy(), 0, d.rows-1)
+	if d.cursor.row == d.scrollRegion[1] {
+		d.Scroll(1)
+	} else if d.cursor.row < d.rows-1 {
+		d.cursor.row++
+	}
+}
+
+func (sd *sixelDecoder) decode(data []rune) {
+	var params []int
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case c >= '?' && c <= '~': // sixel data
+			sd.put(c-'?', 1)
+		case c == '!': // repeat introducer: !count sixel
+			params, i = sixelParams(data, i+1)
+			if i+1 < len(data) && data[i+1] >= '?' && data[i+1] <= '~' {
+				i++
+				sd.put(data[i]-'?', max(params[0], 1))
+			}
+		case c == '#': // color introducer: select or define a register
+			params, i = sixelParams(data, i+1)
+			sd.colorIntroducer(params)
+		case c == '"': // raster attributes: Pan;Pad;Ph;Pv
+			params, i = sixelParams(data, i+1)
+			sd.rasterAttributes(params)
+		case c == '$': // graphics carriage return
+			sd.pos.X = 0
+		case c == '-': // graphics new line
+			sd.pos.X = 0
+			sd.pos.Y += 6 * sd.aspect
+		}
+	}
+}
+
+// sixelParams reads ';' separated numbers from data, starting at i. It
+// returns them along with the index of the last rune consumed. There is
+// always at least one number.
+func sixelParams(data []rune, i int) (params []int, last int) {
+	n := 0
+	for ; i < len(data); i++ {
+		c := data[i]
+		if c == ';' {
+			params = append(params, n)
+			n = 0
+			continue
+		}
+		if c < '0' || c > '9' {
+			break
+		}
+		// clamp instead of overflowing on garbage
+		n = min(n*10+int(c-'0'), 1<<20)
+	}
+	return append(params, n), i - 1
+}
+
+func (sd *sixelDecoder) colorIntroducer(params []int) {
+	reg := params[0] % sixelRegisters
+	if len(params) >= 5 {
+		switch params[1] {
+		case 1: // HLS
+			sd.palette[reg] = sixelHLS(params[2], params[3], params[4])
+		case 2: // RGB
+			sd.palette[reg] = sixelRGB(params[2], params[3], params[4])
+		}
+	}
+	sd.color = sd.palette[reg]
+}
+
+func (sd *sixelDecoder) rasterAttributes(params []int) {
+	for len(params) < 4 {
+		params = append(params, 0)
+	}
+	if params[0] > 0 && params[1] > 0 {
+		sd.aspect = max((params[0]+params[1]/2)/params[1], 1)
+	}
+	if sd.transparent || params[2] <= 0 || params[3] <= 0 {
+		return
+	}
+	size := image.Pt(params[2], params[3])
+	sd.makeRoom(size.Y)
+	sd.d.Render.Fill(image.Rectangle{Max: size}.Add(sd.origin), sd.palette[0])
+	sd.extent.X = max(sd.extent.X, size.X)
+	sd.extent.Y = max(sd.extent.Y, size.Y)
+}
+
+// makeRoom scrolls the screen, when sixel scrolling is enabled, so that the
+// image is visible down to height pixels below origin.
+func (sd *sixelDecoder) makeRoom(height int) {
+	if !sd.scrolling {
+		return
+	}
+	over := sd.origin.Y + height - sd.d.Render.bounds.Max.Y
+	if over <= 0 {
+		return
+	}
+	rows := (over + sd.d.Render.cell.Dy() - 1) / sd.d.Render.cell.Dy()
+	sd.d.Scroll(rows)
+	sd.origin.Y -= rows * sd.d.Render.cell.Dy()
+}
+
+// put draws one sixel, repeated count times, at the sixel cursor and advances
+// it.
+func (sd *sixelDecoder) put(bits rune, count int) {
+	if bits != 0 {
+		sd.makeRoom(sd.pos.Y + 6*sd.aspect)
+		x := sd.origin.X + sd.pos.X
+		for b := 0; b < 6; b++ {
+			if bits&(1<<b) == 0 {
+				continue
+			}
+			y := sd.origin.Y + sd.pos.Y + b*sd.aspect
+			sd.fill(image.Rect(x, y, x+count, y+sd.aspect))
+		}
+		sd.extent.Y = max(sd.extent.Y, sd.pos.Y+6*sd.aspect)
+	}
+	sd.pos.X += count
+	sd.extent.X = max(sd.extent.X, sd.pos.X)
+}
+
+func (sd *sixelDecoder) fill(r image.Rectangle) {
+	if r.Dx() == 1 && r.Dy() == 1 {
+		sd.d.Render.Set(r.Min.X, r.Min.Y, sd.color)
+		return
+	}
+	sd.d.Render.Fill(r, sd.color)
+}
+
+// sixelRGB converts percentages to a Color.
+func sixelRGB(r, g, b int) Color {
+	pct := func(v int) uint8 {
+		return uint8(bound(v, 0, 100) * 255 / 100)
+	}
+	return NewOpaqueColor(pct(r), pct(g), pct(b))
+}
+
+// sixelHLS converts DEC's HLS to a Color. DEC puts blue at 0 degrees, red at
+// 120 and green at 240; lightness and saturation are percentages.
+func sixelHLS(h, l, s int) Color {
+	hue := math.Mod(float64(h+240), 360) / 360
+	light := float64(bound(l, 0, 100)) / 100
+	sat := float64(bound(s, 0, 100)) / 100
+
+	if sat == 0 {
+		v := uint8(light * 255)
+		return NewOpaqueColor(v, v, v)
+	}
+
+	var q float64
+	if light < 0.5 {
+		q = light * (1 + sat)
+	} else {
+		q = light + sat - light*sat
+	}
+	p := 2*light - q
+
+	channel := func(t float64) uint8 {
+		t = t - math.Floor(t)
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 1.0/2:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+		return uint8(math.Round(v * 255))
+	}
+
+	return NewOpaqueColor(channel(hue+1.0/3), channel(hue), channel(hue-1.0/3))
+}
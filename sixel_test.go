@@ -0,0 +1,140 @@
+package fansiterm
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// sameColor is whether two colors come out the same.
+func sameColor(a, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	return ar == br && ag == bg && ab == bb && aa == ba
+}
+
+func TestSixel(t *testing.T) {
+	red := NewOpaqueColor(255, 0, 0)
+	green := NewOpaqueColor(0, 255, 0)
+	blue := NewOpaqueColor(0, 0, 255)
+	white := NewOpaqueColor(255, 255, 255)
+	type pixel struct {
+		pt   image.Point
+		want Color
+		set  bool // false means the pixel must not be want
+	}
+	tests := []struct {
+		name   string
+		seq    string
+		pixels []pixel
+	}{
+		{"rgb", "\x1bPq#1;2;100;0;0~\x1b\\", []pixel{
+			{image.Pt(0, 0), red, true},
+			{image.Pt(0, 5), red, true},
+			{image.Pt(0, 6), red, false},
+			{image.Pt(1, 0), red, false},
+		}},
+		{"hls red", "\x1bPq#1;1;120;50;100~\x1b\\", []pixel{{image.Pt(0, 0), red, true}}},
+		{"hls green", "\x1bPq#1;1;240;50;100~\x1b\\", []pixel{{image.Pt(0, 0), green, true}}},
+		{"hls blue", "\x1bPq#1;1;0;50;100~\x1b\\", []pixel{{image.Pt(0, 0), blue, true}}},
+		{"hls grey", "\x1bPq#1;1;0;100;0~\x1b\\", []pixel{{image.Pt(0, 0), white, true}}},
+		{"default register", "\x1bPq#2~\x1b\\", []pixel{{image.Pt(0, 0), sixelRGB(80, 13, 13), true}}},
+		{"bits", "\x1bPq#1;2;100;0;0A\x1b\\", []pixel{
+			// A is 0b000010: only the second pixel down
+			{image.Pt(0, 0), red, false},
+			{image.Pt(0, 1), red, true},
+			{image.Pt(0, 2), red, false},
+		}},
+		{"repeat", "\x1bPq#1;2;100;0;0!5~\x1b\\", []pixel{
+			{image.Pt(0, 0), red, true},
+			{image.Pt(4, 5), red, true},
+			{image.Pt(5, 0), red, false},
+		}},
+		{"repeat blank", "\x1bPq#1;2;100;0;0!3?~\x1b\\", []pixel{
+			{image.Pt(2, 0), red, false},
+			{image.Pt(3, 0), red, true},
+		}},
+		{"carriage return", "\x1bPq#1;2;100;0;0~~$#2;2;0;0;100~\x1b\\", []pixel{
+			{image.Pt(0, 0), blue, true},
+			{image.Pt(1, 0), red, true},
+		}},
+		{"new line", "\x1bPq#1;2;100;0;0~~-~\x1b\\", []pixel{
+			{image.Pt(0, 6), red, true},
+			{image.Pt(1, 6), red, false},
+		}},
+		{"aspect", "\x1bPq\"2;1#1;2;100;0;0@-@\x1b\\", []pixel{
+			// each bit is two pixels tall, so the band is twelve
+			{image.Pt(0, 1), red, true},
+			{image.Pt(0, 2), red, false},
+			{image.Pt(0, 12), red, true},
+		}},
+		{"raster opaque", "\x1bP0;0q#0;2;0;0;100\"1;1;10;12\x1b\\", []pixel{
+			{image.Pt(0, 0), blue, true},
+			{image.Pt(9, 11), blue, true},
+			{image.Pt(10, 11), blue, false},
+			{image.Pt(9, 12), blue, false},
+		}},
+		{"raster transparent", "\x1bP0;1q#0;2;0;0;100\"1;1;10;12\x1b\\", []pixel{
+			{image.Pt(0, 0), blue, false},
+			{image.Pt(9, 11), blue, false},
+		}},
+	}
+	for _, tt := range tests {
+		d := New(10, 4, nil)
+		d.write([]byte(tt.seq))
+		for _, p := range tt.pixels {
+			if got := sameColor(d.Render.At(p.pt.X, p.pt.Y), p.want); got != p.set {
+				t.Errorf("%s: %v is %v, want it set to %v: %v", tt.name, p.pt, d.Render.At(p.pt.X, p.pt.Y), p.want, p.set)
+			}
+		}
+	}
+}
+
+func TestSixelCursor(t *testing.T) {
+	// four bands of six pixels make an image 24 pixels, a row and a half, tall
+	const image24 = "\x1bPq~-~-~-~\x1b\\"
+	tests := []struct {
+		name string
+		seq  string
+		want image.Point
+	}{
+		{"one band", "\x1b[1;3H\x1bPq~\x1b\\", image.Pt(2, 1)},
+		{"two rows", "\x1b[1;3H" + image24, image.Pt(2, 2)},
+		{"nothing drawn", "\x1b[1;3H\x1bPq$-\x1b\\", image.Pt(2, 0)},
+		{"scrolled", "\x1b[4;3H" + image24, image.Pt(2, 3)},
+		{"no scrolling", "\x1b[?80h\x1b[1;3H" + image24, image.Pt(2, 0)},
+		{"scrolling again", "\x1b[?80h\x1b[?80l\x1b[1;3H" + image24, image.Pt(2, 2)},
+	}
+	for _, tt := range tests {
+		d := New(10, 4, nil)
+		d.write([]byte(tt.seq))
+		if got := image.Pt(d.cursor.col, d.cursor.row); got != tt.want {
+			t.Errorf("%s: cursor at %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSixelPlacement(t *testing.T) {
+	red := NewOpaqueColor(255, 0, 0)
+	d := New(10, 4, nil)
+	// with scrolling, the image goes at the cursor
+	d.write([]byte("\x1b[2;3H\x1bPq#1;2;100;0;0@\x1b\\"))
+	if !sameColor(d.Render.At(16, 16), red) {
+		t.Errorf("scrolling: not drawn at the cursor")
+	}
+
+	d = New(10, 4, nil)
+	// without, it goes in the top left corner
+	d.write([]byte("\x1b[?80h\x1b[2;3H\x1bPq#1;2;100;0;0@\x1b\\"))
+	if !sameColor(d.Render.At(0, 0), red) || sameColor(d.Render.At(16, 16), red) {
+		t.Errorf("no scrolling: not drawn in the corner")
+	}
+
+	d = New(10, 4, nil)
+	// the screen scrolls a row to fit the image and another to leave the
+	// cursor below it, taking the top of the image up two rows
+	d.write([]byte("\x1b[4;1H\x1bPq#1;2;100;0;0@-#2~-~-~\x1b\\"))
+	if !sameColor(d.Render.At(0, 16), red) || sameColor(d.Render.At(0, 17), red) {
+		t.Errorf("scrolled: top of the image not moved up two rows")
+	}
+}
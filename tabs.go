@@ -0,0 +1,50 @@
+package fansiterm
+
+// tabs.go tracks tab stops. Until HTS or TBC changes them, there's a stop
+// every Config.TabSize columns.
+
+// materializeTabStops fills in tabStops from Config.TabSize so individual
+// stops can be changed.
+func (d *Device) materializeTabStops() {
+	if len(d.tabStops) == d.cols {
+		return
+	}
+	stops := make([]bool, d.cols)
+	for col := range stops {
+		if col < len(d.tabStops) {
+			stops[col] = d.tabStops[col]
+		} else if d.Config.TabSize > 0 {
+			stops[col] = col%d.Config.TabSize == 0
+		}
+	}
+	d.tabStops = stops
+}
+
+// setTabStop sets or clears the tab stop at the cursor.
+func (d *Device) setTabStop(set bool) {
+	if d.cursor.col >= d.cols {
+		return
+	}
+	d.materializeTabStops()
+	d.tabStops[d.cursor.col] = set
+}
+
+// clearTabStops clears every tab stop.
+func (d *Device) clearTabStops() {
+	d.tabStops = make([]bool, d.cols)
+}
+
+// nextTabStop returns the column of the next tab stop after the cursor, or
+// the last column if there isn't one.
+func (d *Device) nextTabStop() int {
+	for col := d.cursor.col + 1; col < d.cols; col++ {
+		if d.tabStops == nil {
+			if d.Config.TabSize > 0 && col%d.Config.TabSize == 0 {
+				return col
+			}
+		} else if col < len(d.tabStops) && d.tabStops[col] {
+			return col
+		}
+	}
+	return d.cols - 1
+}
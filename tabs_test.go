@@ -0,0 +1,43 @@
+package fansiterm
+
+import "testing"
+
+func TestTabStops(t *testing.T) {
+	d := New(30, 4, nil)
+	tab := func() int {
+		d.write([]byte("\r\t"))
+		return d.cursor.col
+	}
+
+	if got := tab(); got != 8 {
+		t.Errorf("default tab stop: column %d, want 8", got)
+	}
+
+	// HTS at column 3
+	d.write([]byte("\x1b[4G\x1bH"))
+	if got := tab(); got != 3 {
+		t.Errorf("after HTS: column %d, want 3", got)
+	}
+
+	// TBC 0 clears just the stop under the cursor
+	d.write([]byte("\x1b[4G\x1b[g"))
+	if got := tab(); got != 8 {
+		t.Errorf("after TBC 0: column %d, want 8", got)
+	}
+	d.write([]byte("\x1b[9G\x1b[0g"))
+	if got := tab(); got != 16 {
+		t.Errorf("after TBC 0 at column 8: column %d, want 16", got)
+	}
+
+	// TBC 3 clears them all, leaving tab to go to the last column
+	d.write([]byte("\x1b[3g"))
+	if got := tab(); got != 29 {
+		t.Errorf("after TBC 3: column %d, want 29", got)
+	}
+
+	// and a reset brings back the defaults
+	d.write([]byte("\x1bc"))
+	if got := tab(); got != 8 {
+		t.Errorf("after reset: column %d, want 8", got)
+	}
+}
@@ -0,0 +1,279 @@
+package fansiterm
+
+import (
+	"image"
+	"image/draw"
+)
+
+// tek.go implements xterm-style Tektronix 4014 emulation. CSI ? 38 h switches
+// the Device into Tek mode, where every byte goes to the Tek state machine
+// instead of the VT parser, until ESC ETX switches back.
+//
+// Tek coordinates are 12 bit: 4096x3120 with the origin in the bottom left.
+// They are scaled to fill Render's bounds.
+
+const (
+	tekWidth  = 4096
+	tekHeight = 3120
+)
+
+type tekMode int
+
+const (
+	tekAlpha tekMode = iota
+	tekGraph
+	tekPoint
+	tekIncremental
+)
+
+type tekState struct {
+	active bool
+	mode   tekMode
+	// pos is the beam position in Tek coordinates.
+	pos image.Point
+	// dark is set when the next vector only moves the beam.
+	dark bool
+	// penDown is whether incremental plot moves draw.
+	penDown bool
+	// esc is set if the previous byte was ESC.
+	esc bool
+
+	// address bytes; any but the low X byte may be left out if unchanged
+	hiY, loY, hiX, extra int
+	// lastLoY is set when the previous byte was a low Y (or extra) byte.
+	lastLoY bool
+	// gotLoY is set once the low Y byte of this address has arrived, after
+	// which a high byte is high X rather than high Y.
+	gotLoY bool
+
+	// saved is the VT screen, if AltScreen is enabled.
+	saved draw.Image
+}
+
+// enterTek switches to Tek mode, clearing the screen. If AltScreen is enabled
+// the VT screen is saved and restored by exitTek.
+func (d *Device) enterTek() {
+	if d.tek.active {
+		return
+	}
+	d.hideCursor()
+	d.tek = tekState{active: true}
+	if d.Config.AltScreen {
+		d.tek.saved = image.NewRGBA(d.Render.bounds)
+		draw.Draw(d.tek.saved, d.Render.bounds, d.Render, d.Render.bounds.Min, draw.Src)
+	}
+	d.tekPage()
+}
+
+// exitTek returns to VT mode.
+func (d *Device) exitTek() {
+	if !d.tek.active {
+		return
+	}
+	if d.tek.saved != nil {
+		draw.Draw(d.Render, d.Render.bounds, d.tek.saved, d.Render.bounds.Min, draw.Src)
+	} else {
+		d.clearAll()
+		d.cursor.MoveAbs(0, 0)
+	}
+	d.tek = tekState{}
+}
+
+// tekPage clears the screen and homes the beam, like the PAGE key.
+func (d *Device) tekPage() {
+	d.clearAll()
+	d.tek.mode = tekAlpha
+	d.tek.pos = image.Pt(0, tekHeight-d.tekLineHeight())
+}
+
+// tekToPixel converts Tek coordinates to Render's coordinates.
+func (d *Device) tekToPixel(pt image.Point) image.Point {
+	b := d.Render.Bounds()
+	return image.Pt(
+		b.Min.X+pt.X*b.Dx()/tekWidth,
+		b.Max.Y-1-pt.Y*b.Dy()/tekHeight,
+	)
+}
+
+// tekCharWidth and tekLineHeight are the size of a cell in Tek units, so that
+// alpha mode text is the same size as VT text.
+func (d *Device) tekCharWidth() int {
+	return max(d.Render.cell.Dx()*tekWidth/max(d.Render.Bounds().Dx(), 1), 1)
+}
+
+func (d *Device) tekLineHeight() int {
+	return max(d.Render.cell.Dy()*tekHeight/max(d.Render.Bounds().Dy(), 1), 1)
+}
+
+// tekRune feeds a single rune to the Tek state machine.
+func (d *Device) tekRune(r rune) {
+	t := &d.tek
+
+	if t.esc {
+		t.esc = false
+		switch r {
+		case 0x03: // ETX: back to VT mode
+			d.exitTek()
+		case 0x0C: // FF: clear the screen
+			d.tekPage()
+		}
+		// character sizes, line styles and GIN mode are not supported
+		return
+	}
+
+	switch r {
+	case 0x1b:
+		t.esc = true
+		return
+	case '\a':
+		if d.BellFunc != nil {
+			d.BellFunc("bel")
+		}
+		return
+	case 0x1c: // FS: point plot mode
+		t.mode = tekPoint
+		t.gotLoY = false
+		return
+	case 0x1d: // GS: graph mode; the first vector is dark
+		t.mode = tekGraph
+		t.dark = true
+		t.gotLoY = false
+		return
+	case 0x1e: // RS: incremental plot mode
+		t.mode = tekIncremental
+		t.penDown = false
+		return
+	case 0x1f: // US: alpha mode
+		t.mode = tekAlpha
+		return
+	case '\r':
+		// carriage return also drops out of the graphics modes
+		t.mode = tekAlpha
+		t.pos.X = 0
+		return
+	}
+
+	switch t.mode {
+	case tekAlpha:
+		d.tekAlpha(r)
+	case tekGraph, tekPoint:
+		d.tekAddress(r)
+	case tekIncremental:
+		d.tekIncrement(r)
+	}
+}
+
+// tekAlpha handles a rune in alpha mode. The beam is at the bottom left of
+// the character.
+func (d *Device) tekAlpha(r rune) {
+	t := &d.tek
+	cw, lh := d.tekCharWidth(), d.tekLineHeight()
+	switch {
+	case r == '\b':
+		t.pos.X = max(t.pos.X-cw, 0)
+	case r == '\t':
+		t.pos.X += cw
+	case r == '\n':
+		t.pos.Y -= lh
+		if t.pos.Y < 0 {
+			// wrap around to the top
+			t.pos.Y = tekHeight - lh
+		}
+	case r == '\v':
+		t.pos.Y = min(t.pos.Y+lh, tekHeight-lh)
+	case r >= 0x20:
+		if t.pos.X+cw > tekWidth {
+			t.pos.X = 0
+			d.tekAlpha('\n')
+		}
+		pt := d.tekToPixel(t.pos).Sub(image.Pt(0, d.Render.cell.Dy()-1))
+		(*d.Render.active.tileSet).DrawTile(r, d.Render, pt, d.Render.active.fg, d.Render.active.bg)
+		t.pos.X += cw
+	}
+}
+
+// tekAddress decodes the bytes of an address in graph and point plot modes.
+// A complete address ends with the low X byte.
+func (d *Device) tekAddress(r rune) {
+	t := &d.tek
+	switch {
+	case r >= 0x20 && r <= 0x3f: // high Y or high X
+		if t.gotLoY {
+			t.hiX = int(r & 0x1f)
+		} else {
+			t.hiY = int(r & 0x1f)
+		}
+		t.lastLoY = false
+	case r >= 0x60 && r <= 0x7f: // low Y, or the extra byte if two in a row
+		if t.lastLoY {
+			t.extra = t.loY
+		}
+		t.loY = int(r & 0x1f)
+		t.gotLoY = true
+		t.lastLoY = true
+	case r >= 0x40 && r <= 0x5f: // low X; the address is complete
+		loX := int(r & 0x1f)
+		to := image.Pt(
+			t.hiX<<7|loX<<2|t.extra&3,
+			t.hiY<<7|t.loY<<2|(t.extra>>2)&3,
+		)
+		t.gotLoY = false
+		t.lastLoY = false
+		d.tekPlot(to)
+	}
+}
+
+// tekPlot acts on a complete address.
+func (d *Device) tekPlot(to image.Point) {
+	t := &d.tek
+	switch {
+	case t.mode == tekPoint:
+		pt := d.tekToPixel(to)
+		d.Render.Set(pt.X, pt.Y, d.Render.active.fg)
+	case t.dark:
+		t.dark = false
+	default:
+		drawLine(d.Render, d.tekToPixel(t.pos), d.tekToPixel(to), d.Render.active.fg)
+	}
+	t.pos = to
+}
+
+// tekIncrement handles a rune in incremental plot mode. Each step moves the
+// beam one 10 bit unit in the given direction.
+func (d *Device) tekIncrement(r rune) {
+	t := &d.tek
+	var step image.Point
+	switch r {
+	case ' ':
+		t.penDown = false
+		return
+	case 'P':
+		t.penDown = true
+		return
+	case 'D':
+		step = image.Pt(0, 1)
+	case 'E':
+		step = image.Pt(1, 1)
+	case 'A':
+		step = image.Pt(1, 0)
+	case 'I':
+		step = image.Pt(1, -1)
+	case 'H':
+		step = image.Pt(0, -1)
+	case 'J':
+		step = image.Pt(-1, -1)
+	case 'B':
+		step = image.Pt(-1, 0)
+	case 'F':
+		step = image.Pt(-1, 1)
+	default:
+		return
+	}
+	t.pos = t.pos.Add(step.Mul(4))
+	t.pos.X = bound(t.pos.X, 0, tekWidth-1)
+	t.pos.Y = bound(t.pos.Y, 0, tekHeight-1)
+	if t.penDown {
+		pt := d.tekToPixel(t.pos)
+		d.Render.Set(pt.X, pt.Y, d.Render.active.fg)
+	}
+}
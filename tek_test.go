@@ -0,0 +1,36 @@
+package fansiterm
+
+import (
+	"image"
+	"testing"
+)
+
+func TestTekAddress(t *testing.T) {
+	d := New(80, 24, nil)
+	d.write([]byte("\x1b[?38h\x1c"))
+
+	// each step continues from the address before it, so bytes that are
+	// left out keep their previous value
+	tests := []struct {
+		name  string
+		input string
+		want  image.Point
+	}{
+		{"full address", "!b#D", image.Pt(3<<7|4<<2, 1<<7|2<<2)},
+		{"extra byte", "!fb#D", image.Pt(3<<7|4<<2|2, 1<<7|2<<2|1)},
+		{"low y and low x", "cE", image.Pt(3<<7|5<<2|2, 1<<7|3<<2|1)},
+		{"low x only", "F", image.Pt(3<<7|6<<2|2, 1<<7|3<<2|1)},
+		{"high x after low y", "d$G", image.Pt(4<<7|7<<2|2, 1<<7|4<<2|1)},
+	}
+	for _, tt := range tests {
+		d.write([]byte(tt.input))
+		if d.tek.pos != tt.want {
+			t.Errorf("%s: pos = %v, want %v", tt.name, d.tek.pos, tt.want)
+		}
+	}
+
+	d.Reset()
+	if d.tek.active {
+		t.Error("Reset left Tek mode active")
+	}
+}
@@ -0,0 +1,50 @@
+package fansiterm
+
+import "unicode/utf8"
+
+// UTF8Policy says what to do with bytes that aren't valid UTF-8.
+type UTF8Policy int
+
+const (
+	// UTF8Replace turns each invalid byte into U+FFFD.
+	UTF8Replace UTF8Policy = iota
+	// UTF8Latin1 passes each invalid byte through as the Latin-1 character
+	// of the same value, which suits hosts that mix in legacy 8-bit text.
+	UTF8Latin1
+	// UTF8Drop discards invalid bytes.
+	UTF8Drop
+)
+
+// decodeUTF8 turns data into runes. A UTF-8 sequence cut off at the end of
+// data is held in utf8Buf and finished by the next write, rather than turning
+// into replacement characters.
+func (d *Device) decodeUTF8(data []byte) []rune {
+	if len(d.utf8Buf) != 0 {
+		data = append(d.utf8Buf, data...)
+		d.utf8Buf = nil
+	}
+
+	runes := make([]rune, 0, len(data))
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size <= 1 {
+			if !utf8.FullRune(data[i:]) {
+				// incomplete, not invalid; wait for the rest
+				d.utf8Buf = append([]byte(nil), data[i:]...)
+				break
+			}
+			switch d.Config.InvalidUTF8 {
+			case UTF8Latin1:
+				runes = append(runes, rune(data[i]))
+			case UTF8Drop:
+			default:
+				runes = append(runes, utf8.RuneError)
+			}
+			i++
+			continue
+		}
+		runes = append(runes, r)
+		i += size
+	}
+	return runes
+}
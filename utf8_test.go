@@ -0,0 +1,43 @@
+package fansiterm
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDecodeUTF8(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy UTF8Policy
+		// writes are decoded one after another
+		writes []string
+		want   string
+	}{
+		{"ascii", UTF8Replace, []string{"abc"}, "abc"},
+		{"multibyte", UTF8Replace, []string{"é€😀"}, "é€😀"},
+		{"overlong nul", UTF8Replace, []string{"\xc0\x80"}, "��"},
+		{"overlong slash", UTF8Replace, []string{"\xe0\x80\xaf"}, "���"},
+		{"surrogate", UTF8Replace, []string{"\xed\xa0\x80"}, "���"},
+		{"past U+10FFFF", UTF8Replace, []string{"\xf4\x90\x80\x80"}, "����"},
+		{"stray continuation", UTF8Replace, []string{"a\x80b"}, "a�b"},
+		{"split two bytes", UTF8Replace, []string{"\xc3", "\xa9"}, "é"},
+		{"split three ways", UTF8Replace, []string{"\xf0\x9f", "\x98", "\x80!"}, "😀!"},
+		{"split then invalid", UTF8Replace, []string{"\xe2\x82", "A"}, "��A"},
+		{"truncated held back", UTF8Replace, []string{"a\xe2\x82"}, "a"},
+		{"latin1", UTF8Latin1, []string{"a\xe9\xc0\x80"}, "aéÀ\u0080"},
+		{"drop", UTF8Drop, []string{"a\xff\xc0\x80b"}, "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(10, 4, nil)
+			d.Config.InvalidUTF8 = tt.policy
+			var got []rune
+			for _, w := range tt.writes {
+				got = append(got, d.decodeUTF8([]byte(w))...)
+			}
+			if want := []rune(tt.want); !slices.Equal(got, want) {
+				t.Errorf("got %q, want %q", string(got), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package fansiterm
+
+// vt52.go implements VT52 compatibility mode, entered with DECANM (CSI ? 2 l)
+// and left with ESC <. In VT52 mode escape sequences are just ESC and a
+// single letter, except for direct cursor addressing, ESC Y row col.
+
+// consumeVT52Sequence figures out where the VT52 escape sequence in data
+// ends. It assumes data[0] == 0x1b.
+func consumeVT52Sequence(data []rune) (n int, err error) {
+	if len(data) < 2 {
+		return 0, errEscapeSequenceIncomplete
+	}
+	if data[1] == 'Y' {
+		if len(data) < 4 {
+			return 0, errEscapeSequenceIncomplete
+		}
+		return 4, nil
+	}
+	return 2, nil
+}
+
+// handleVT52Sequence handles a complete VT52 escape sequence.
+func (d *Device) handleVT52Sequence(seq []rune) {
+	if ShowEsc {
+		log.Info("handling VT52 escape sequence", "sequence", seqString(seq))
+	}
+	switch seq[1] {
+	case 'A': // cursor up
+		d.cursor.MoveRel(0, -1)
+	case 'B': // cursor down
+		d.cursor.MoveRel(0, 1)
+	case 'C': // cursor right
+		d.cursor.MoveRel(1, 0)
+	case 'D': // cursor left
+		d.cursor.MoveRel(-1, 0)
+	case 'F': // enter graphics mode
+		d.Render.active.g[0] = &d.Render.AltCharSet
+	case 'G': // exit graphics mode
+		d.Render.active.g[0] = &d.Render.CharSet
+	case 'H': // cursor home
+		d.cursor.MoveAbs(0, 0)
+	case 'I': // reverse line feed
+		if d.cursor.row == 0 {
+			d.Scroll(-1)
+		} else {
+			d.cursor.row--
+		}
+	case 'J': // erase to end of screen
+		d.Clear(d.cursor.col, d.cursor.row, d.cols, d.cursor.row+1)
+		d.Clear(0, d.cursor.row+1, d.cols, d.rows)
+	case 'K': // erase to end of line
+		d.Clear(d.cursor.col, d.cursor.row, d.cols, d.cursor.row+1)
+	case 'Y': // direct cursor address; row and column are offset by 32
+		d.cursor.MoveAbs(int(seq[3])-32, int(seq[2])-32)
+	case 'Z': // identify as a VT52
+		d.output().Write([]byte{0x1b, '/', 'Z'})
+	case '<': // back to ANSI mode
+		d.vt52 = false
+		d.configChange()
+	case '=', '>': // alternate keypad mode on/off
+		d.Config.KeypadApplicationMode = seq[1] == '='
+		d.configChange()
+	default:
+		if ShowUnhandled {
+			log.Warn("unhandled VT52 escape sequence", "sequence", seqString(seq))
+		}
+	}
+	d.updateAttr()
+}
@@ -5,7 +5,6 @@
 package fansiterm
 
 import (
-	"bytes"
 	"image"
 	"image/color"
 	"image/draw"
@@ -37,6 +36,10 @@ type Device struct {
 	ConfigUpdate func(conf Config)
 	// Consider adding a ConfigSet func(Config) field. Just sayin'
 
+	// PropertyUpdate, if non-nil, is called when a Property (like the window
+	// title) changes. ConfigUpdate is still called as well.
+	PropertyUpdate func(change PropertyChange)
+
 	// cols and rows specify the size in characters of the terminal.
 	cols, rows int
 
@@ -58,13 +61,69 @@ type Device struct {
 	// Render collects together all the graphical rendering fields.
 	Render Render
 
-	// inputBuf buffers chracters between write calls. This is exclusively used to
-	// buffer incomplete escape sequences.
-	inputBuf []rune
+	// input is the parser and whatever else is kept of the input between
+	// write calls, e.g. an unfinished escape sequence.
+	input inputState
+
+	// utf8Buf holds the start of a UTF-8 sequence that was split between
+	// writes.
+	utf8Buf []byte
+
+	// docsBuf holds an ESC or ESC % from the end of the last write, which
+	// may turn out to be the start of an ESC % G or ESC % @.
+	docsBuf []byte
+
+	// titleStack holds titles saved with CSI 22 t.
+	titleStack []titleStackEntry
+
+	// kitty holds images sent with the kitty graphics protocol.
+	kitty kittyGraphics
+
+	// regis is the ReGIS graphics state, which persists between sequences.
+	regis regisState
+
+	// vt52 is set when in VT52 mode (DECANM reset), which changes how escape
+	// sequences are parsed.
+	vt52 bool
+
+	// tek is the Tektronix 4014 state. While tek.active is set, everything
+	// written goes to the Tek state machine.
+	tek tekState
+
+	// blink tracks the cells with blinking text.
+	blink blinkState
+
+	// c1Replies is set by S8C1T, to send replies with 8-bit C1 controls.
+	c1Replies bool
+
+	// tabStops are the columns with tab stops. If nil, there's a stop every
+	// Config.TabSize columns.
+	tabStops []bool
+
+	// cluster is the last grapheme cluster drawn, which may yet be extended
+	// by the next write.
+	cluster lastCluster
+
+	// mouse is the mouse reporting state.
+	mouse mouseState
+
+	// keyFlagStack is the stack of kitty keyboard protocol enhancement
+	// flags; the last entry is in effect.
+	keyFlagStack []int
+
+	// handlers are the escape sequence handlers registered with HandleCSI
+	// and friends.
+	handlers handlerRegistry
 
 	// saveBuf is used to store the main buffer when the alternate screen
 	// is used.
 	saveBuf draw.Image
+	// saveBlink is the record of blinking cells on the main screen while
+	// the alternate screen is used.
+	saveBlink map[image.Point]blinkCell
+	// saveKeyFlags is keyFlagStack of the main screen; the alternate screen
+	// has a stack of its own.
+	saveKeyFlags []int
 
 	// Output specifies the program attached to the terminal. This should be the
 	// same interface that the input mechanism (whatever that may be) uses to write
@@ -73,6 +132,15 @@ type Device struct {
 	// write a response to panic.
 	Output io.Writer
 
+	// ResizeRequestFunc, if non-nil, is called when the host asks for the
+	// terminal to be resized with CSI 8 ; rows ; cols t (or CSI 4 t, in pixels,
+	// which is converted to cells). A zero value means keep the current size
+	// in that dimension; it has already been filled in. Fansiterm can't
+	// resize the display itself, so it is up to ResizeRequestFunc to decide
+	// whether to honor the request, e.g. by calling UseBuf with a
+	// differently sized buffer.
+	ResizeRequestFunc func(rows, cols int)
+
 	// UserResetFunc is called when fansiterm's Reset() method is called. This
 	// is the same Reset triggered by an \x1bc escape sequence. This can be used
 	// to reset a hardware display.
@@ -87,6 +155,10 @@ type Device struct {
 	// sized such that it never blocks.
 	writeQueue chan []byte
 
+	// flushQueue takes a channel for the queueHandler to close once it has
+	// written everything in writeQueue.
+	flushQueue chan chan struct{}
+
 	done chan struct{}
 
 	sync.Mutex
@@ -97,15 +169,43 @@ type Attr struct {
 	Bold            bool
 	Underline       bool
 	DoubleUnderline bool
-	Strike          bool
-	Blink           bool
-	Reversed        bool
-	Italic          bool
-	Conceal         bool
-	Fg              Color
-	Bg              Color
+	// UnderlineStyle selects a curly, dotted or dashed underline. It only
+	// matters if Underline is set and DoubleUnderline is not.
+	UnderlineStyle UnderlineStyle
+	// UnderlineColor is used for underlines, instead of Fg, if
+	// UnderlineColored is set.
+	UnderlineColor   Color
+	UnderlineColored bool
+	Strike           bool
+	Blink            bool
+	RapidBlink       bool
+	Reversed         bool
+	Italic           bool
+	Conceal          bool
+	// Faint text is drawn with Fg blended toward Bg.
+	Faint    bool
+	Overline bool
+	// Framed and Encircled draw a box or an ellipse around each cell.
+	Framed    bool
+	Encircled bool
+	// Superscript and Subscript draw the glyph at half height in the top
+	// or bottom half of the cell.
+	Superscript bool
+	Subscript   bool
+	Fg          Color
+	Bg          Color
 }
 
+// UnderlineStyle is the shape of an underline, as set by SGR 4:n.
+type UnderlineStyle int
+
+const (
+	UnderlineStraight UnderlineStyle = iota
+	UnderlineCurly
+	UnderlineDotted
+	UnderlineDashed
+)
+
 // New initializes a new terminal device with the specified dimensions and optional draw.Image buffer.
 // If buf is nil, a default in-memory RGBA buffer is allocated. The terminal's character size is fixed.
 func New(cols, rows int, buf draw.Image) *Device {
@@ -142,6 +242,7 @@ func New(cols, rows int, buf draw.Image) *Device {
 
 	d := &Device{
 		writeQueue: make(chan []byte, 256),
+		flushQueue: make(chan chan struct{}),
 		done:       make(chan struct{}),
 		// bufChan:    make(chan draw.Image),
 		cols: cols,
@@ -233,8 +334,7 @@ func (d *Device) UseBuf(buf draw.Image) {
 
 func (d *Device) useBuf(buf draw.Image) {
 	cell := d.Render.cell
-	d.cols = buf.Bounds().Dx() / 8
-	d.rows = buf.Bounds().Dy() / 16
+	d.resize(buf.Bounds().Dx()/8, buf.Bounds().Dy()/16)
 
 	// save the old buf
 	origBuf := copyImage(d.Render.Image)
@@ -324,6 +424,46 @@ func (d *Device) Reset() {
 	d.cursor.MoveAbs(0, 0)
 	d.scrollArea = image.Rectangle{}
 	d.scrollRegion = [2]int{0, d.rows - 1}
+	d.kitty = kittyGraphics{}
+	d.regis = regisState{}
+	d.tek = tekState{}
+	d.vt52 = false
+	d.cluster = lastCluster{}
+	d.input.reset()
+	d.utf8Buf = nil
+	d.c1Replies = false
+	d.tabStops = nil
+	d.titleStack = nil
+	d.keyFlagStack = nil
+	d.saveKeyFlags = nil
+}
+
+// resize changes the number of columns and rows, and brings along what
+// depends on them: the cursor, which loses any pending wrap, the scroll
+// region, which is reset, and the tab stops.
+func (d *Device) resize(cols, rows int) {
+	d.cols, d.rows = cols, rows
+	d.cursor.col = bound(d.cursor.col, 0, d.cols-1)
+	d.cursor.row = bound(d.cursor.row, 0, d.rows-1)
+	d.setScrollRegion(0, 0)
+	if d.tabStops != nil {
+		d.materializeTabStops()
+	}
+}
+
+// requestResize passes a resize request on to ResizeRequestFunc. Zero rows or
+// cols mean keep the current value.
+func (d *Device) requestResize(rows, cols int) {
+	if d.ResizeRequestFunc == nil {
+		return
+	}
+	if rows <= 0 {
+		rows = d.rows
+	}
+	if cols <= 0 {
+		cols = d.cols
+	}
+	d.ResizeRequestFunc(rows, cols)
 }
 
 // SetCursorStyle changes the shape of the cursor. Valid options are CursorBlock,
@@ -400,8 +540,9 @@ func (d *Device) Size() (int, int) {
 // Write implements io.Write and is the main way to interract with a (*fansiterm).Device. This is
 // essentially writing to the "terminal."
 // Writes are more or less unbuffered with the exception of escape sequences. If a partial escape sequence
-// is written to Device, the beginning will be bufferred and prepended to the next write.
-// Certain broken escape sequence can potentially block forever.
+// is written to Device, the rest of it is expected from the next write. A sequence that is never finished
+// is ended by CAN or SUB, or by Config.SequenceTimeout; one longer than
+// Config.MaxSequenceLength is discarded up to its terminator.
 func (d *Device) Write(data []byte) (n int, err error) {
 	// this function exists to shorten the amount of code that runs potentially
 	// triggered by an interrupt if we're getting data from UART or SPI.
@@ -416,6 +557,25 @@ func (d *Device) Write(data []byte) (n int, err error) {
 	return len(data), nil
 }
 
+// flush waits until everything passed to Write so far has been written.
+func (d *Device) flush() {
+	done := make(chan struct{})
+	d.flushQueue <- done
+	<-done
+}
+
+// drainQueue writes everything waiting in writeQueue.
+func (d *Device) drainQueue() {
+	for {
+		select {
+		case data := <-d.writeQueue:
+			d.write(data)
+		default:
+			return
+		}
+	}
+}
+
 func (d *Device) Stop() {
 	d.done <- struct{}{}
 }
@@ -440,87 +600,17 @@ func (d *Device) postUpdate() {
 func (d *Device) write(data []byte) (n int, err error) {
 	d.Lock()
 
-	runes := bytes.Runes(data)
+	runes := expandC1(d.decode(data), d.Config.DisableC1)
 
 	d.preUpdate()
 
-	if len(d.inputBuf) != 0 {
-		runes = append(d.inputBuf, runes...)
-		d.inputBuf = []rune{}
-	}
+	d.parseInput(runes)
 
-	for i := 0; i < len(runes); i++ {
-		switch runes[i] {
-		case '\a': // bell
-			if d.BellFunc != nil {
-				d.BellFunc("bel")
-			}
-		case '\b': // backspace
-			// whatever is connected to the terminal needs to handle line/character editing
-			// however, when the terminal gets a backspace, that's the same as just moving cursor
-			// one space to the left. To perform a what looks like an actual backspace you must
-			// send "\b \b".
-			d.cursor.col = max(d.cursor.col-1, 0)
-		case '\t': // tab
-			// move cursor to nearest multiple of TabSize, but don't move to next row
-			d.cursor.col = min(d.cols-1, d.cursor.col+d.Config.TabSize-(d.cursor.col%d.Config.TabSize))
-		case '\r': // carriage return
-			d.cursor.col = 0
-		case '\n': // linefeed
-			d.cursor.col = 0
-			fallthrough
-		case '\v', '\f': // vertical tab and form feed (who uses either any more?!)
-			// if scroll region is not the whole screen, trying to do a new line past the end
-			// of the last row should be treated as a carriage return
-			if d.cursor.row == d.scrollRegion[1] {
-				d.Scroll(1)
-				continue
-			}
-			if d.cursor.row < d.rows-1 {
-				d.cursor.row++
-			}
-		case 0x0E: // shift out (use alt character set)
-			d.Render.active.shift = 1
-			d.updateAttr()
-		case 0x0F: // shift in (use regular char set)
-			d.Render.active.shift = 0
-			d.updateAttr()
-		case 0x1b: // ESC aka ^[
-			n, err = consumeEscSequence(runes[i:])
-			if err != nil {
-				// copy runes[i:] to d.inputBuf and wait for more input
-				d.inputBuf = runes[i:]
-				i += len(runes[i:])
-				break
-			}
-			d.handleEscSequence(runes[i : i+n])
-			i += n - 1
-		default:
-			// if we're past the end of the screen (remember, d.cols=number of columns but cursor.col is 0 indexed)
-			if d.cursor.col == d.cols {
-				// back to the beginning
-				d.cursor.col = 0
-				// scroll if necessary otherwise just move on to the next row
-				if d.cursor.row == d.scrollRegion[1] {
-					d.Scroll(1)
-				} else if d.cursor.row < d.rows-1 {
-					d.cursor.row++
-				}
-			}
-			// Render rune and then
-			// increment cursor by width of rune
-			// FIXME: corner case where a >1 width rune happens
-			// at the last column
-			d.cursor.col += d.RenderRune(runes[i])
-			if d.Config.Wraparound {
-				d.cursor.col = bound(d.cursor.col, 0, d.cols-1)
-			}
-		}
+	// Re-paint cursor if needed; Tek mode has no text cursor
+	if !d.tek.active {
+		d.showCursor()
 	}
 
-	// Re-paint cursor if needed
-	d.showCursor()
-
 	d.postUpdate()
 
 	d.Unlock()
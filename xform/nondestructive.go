@@ -215,3 +215,48 @@ func (we *wrapEdges) At(x, y int) color.Color {
 	}
 	return we.Image.At(x+we.Image.Bounds().Min.X, y+we.Image.Bounds().Min.Y)
 }
+
+// Crop limits img to r. Pixels keep their coordinates; only the bounds change.
+func Crop(img image.Image, r image.Rectangle) *crop {
+	return &crop{
+		Image:  img,
+		bounds: r.Intersect(img.Bounds()),
+	}
+}
+
+type crop struct {
+	image.Image
+	bounds image.Rectangle
+}
+
+func (c *crop) Bounds() image.Rectangle {
+	return c.bounds
+}
+
+// Scale stretches or shrinks img so that it fills bounds, using nearest
+// neighbor sampling.
+func Scale(img image.Image, bounds image.Rectangle) *scale {
+	return &scale{
+		Image:  img,
+		bounds: bounds,
+	}
+}
+
+type scale struct {
+	image.Image
+	bounds image.Rectangle
+}
+
+func (s *scale) At(x, y int) color.Color {
+	src := s.Image.Bounds()
+	if s.bounds.Empty() || src.Empty() {
+		return color.RGBA{}
+	}
+	x = src.Min.X + (x-s.bounds.Min.X)*src.Dx()/s.bounds.Dx()
+	y = src.Min.Y + (y-s.bounds.Min.Y)*src.Dy()/s.bounds.Dy()
+	return s.Image.At(x, y)
+}
+
+func (s *scale) Bounds() image.Rectangle {
+	return s.bounds
+}